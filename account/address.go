@@ -0,0 +1,135 @@
+package account
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/segmentio/ksuid"
+)
+
+// Address is an entry in an account's address book. At most one address of
+// an account is its default for shipping, and one for billing.
+type Address struct {
+	ID              string    `json:"id"`
+	AccountID       string    `json:"accountId"`
+	Label           string    `json:"label"`
+	Recipient       string    `json:"recipient"`
+	Line1           string    `json:"line1"`
+	Line2           string    `json:"line2"`
+	City            string    `json:"city"`
+	PostalCode      string    `json:"postalCode"`
+	Country         string    `json:"country"`
+	DefaultShipping bool      `json:"defaultShipping"`
+	DefaultBilling  bool      `json:"defaultBilling"`
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+const (
+	maxAddressFieldLength = 100
+	maxLabelLength        = 50
+	maxPostalCodeLength   = 16
+)
+
+func (s *AccountService) ListAddresses(ctx context.Context, accountID string) ([]Address, error) {
+	return s.repository.ListAddresses(ctx, accountID)
+}
+
+func (s *AccountService) GetAddress(ctx context.Context, id string) (*Address, error) {
+	return s.repository.GetAddress(ctx, id)
+}
+
+// CreateAddress adds a to the account's address book. The first address of
+// an account becomes its default for both shipping and billing.
+func (s *AccountService) CreateAddress(ctx context.Context, accountID string, a Address) (*Address, error) {
+	if err := normalizeAddress(&a); err != nil {
+		return nil, err
+	}
+	acc, err := s.repository.GetAccountById(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if acc.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+
+	existing, err := s.repository.ListAddresses(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) == 0 {
+		a.DefaultShipping = true
+		a.DefaultBilling = true
+	}
+
+	now := time.Now().UTC()
+	a.ID = ksuid.New().String()
+	a.AccountID = accountID
+	a.CreatedAt = now
+	a.UpdatedAt = now
+	if err := s.repository.PutAddress(ctx, a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// UpdateAddress replaces the fields of the address with the ID of a. The
+// address stays in the same account.
+func (s *AccountService) UpdateAddress(ctx context.Context, a Address) (*Address, error) {
+	if err := normalizeAddress(&a); err != nil {
+		return nil, err
+	}
+
+	stored, err := s.repository.GetAddress(ctx, a.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	a.AccountID = stored.AccountID
+	a.CreatedAt = stored.CreatedAt
+	a.UpdatedAt = time.Now().UTC()
+	if err := s.repository.UpdateAddress(ctx, a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (s *AccountService) DeleteAddress(ctx context.Context, id string) error {
+	return s.repository.DeleteAddress(ctx, id)
+}
+
+// normalizeAddress trims the fields of a, upper-cases its country code and
+// checks that the required fields are present and every field fits.
+func normalizeAddress(a *Address) error {
+	fields := []struct {
+		name     string
+		value    *string
+		required bool
+		max      int
+	}{
+		{"label", &a.Label, false, maxLabelLength},
+		{"recipient", &a.Recipient, true, maxAddressFieldLength},
+		{"line1", &a.Line1, true, maxAddressFieldLength},
+		{"line2", &a.Line2, false, maxAddressFieldLength},
+		{"city", &a.City, true, maxAddressFieldLength},
+		{"postalCode", &a.PostalCode, false, maxPostalCodeLength},
+	}
+	for _, f := range fields {
+		*f.value = strings.TrimSpace(*f.value)
+		if f.required && *f.value == "" {
+			return fmt.Errorf("%w: %s is required", ErrInvalidAddress, f.name)
+		}
+		if utf8.RuneCountInString(*f.value) > f.max {
+			return fmt.Errorf("%w: %s must have at most %d characters", ErrInvalidAddress, f.name, f.max)
+		}
+	}
+
+	a.Country = strings.ToUpper(strings.TrimSpace(a.Country))
+	if len(a.Country) != 2 || strings.Trim(a.Country, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return fmt.Errorf("%w: country must be a two-letter ISO 3166 code", ErrInvalidAddress)
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/jaykapade/cart-microservice/account/pb"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
 type Client struct {
@@ -31,7 +32,7 @@ func (c *Client) PostAccount(ctx context.Context, name string) (*Account, error)
 	if err != nil {
 		return nil, err
 	}
-	return &Account{ID: r.Account.Id, Name: r.Account.Name}, nil
+	return accountFromProto(r.Account), nil
 }
 
 func (c *Client) GetAccount(ctx context.Context, id string) (*Account, error) {
@@ -39,17 +40,170 @@ func (c *Client) GetAccount(ctx context.Context, id string) (*Account, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Account{ID: r.Account.Id, Name: r.Account.Name}, nil
+	return accountFromProto(r.Account), nil
 }
 
-func (c *Client) GetAccounts(ctx context.Context, skip uint64, take uint64) ([]*Account, error) {
-	r, err := c.service.GetAccounts(ctx, &pb.GetAccountsRequest{Skip: skip, Take: take})
+// SearchAccounts returns a page of accounts and the cursor for the next page,
+// which is empty on the last page.
+func (c *Client) SearchAccounts(ctx context.Context, filter AccountFilter, after string, take uint64) ([]*Account, string, error) {
+	r, err := c.service.SearchAccounts(ctx, &pb.SearchAccountsRequest{
+		Filter: filterToProto(filter),
+		After:  after,
+		Take:   take,
+	})
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	accounts := []*Account{}
 	for _, a := range r.Accounts {
-		accounts = append(accounts, &Account{ID: a.Id, Name: a.Name})
+		accounts = append(accounts, accountFromProto(a))
+	}
+	return accounts, r.NextCursor, nil
+}
+
+func (c *Client) UpdateAccount(ctx context.Context, id string, update AccountUpdate) (*Account, error) {
+	req := &pb.UpdateAccountRequest{
+		Id:         id,
+		UpdateMask: &fieldmaskpb.FieldMask{},
+	}
+	if update.Name != nil {
+		req.Name = *update.Name
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, "name")
+	}
+	if update.DisplayName != nil {
+		req.DisplayName = *update.DisplayName
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, "displayName")
+	}
+	if update.Email != nil {
+		req.Email = *update.Email
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, "email")
+	}
+	if update.Phone != nil {
+		req.Phone = *update.Phone
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, "phone")
+	}
+
+	r, err := c.service.UpdateAccount(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return accountFromProto(r.Account), nil
+}
+
+func (c *Client) Register(ctx context.Context, name, email, password string) (*Account, error) {
+	r, err := c.service.Register(ctx, &pb.RegisterRequest{Name: name, Email: email, Password: password})
+	if err != nil {
+		return nil, err
+	}
+	return accountFromProto(r.Account), nil
+}
+
+func (c *Client) Login(ctx context.Context, email, password string) (*AccessToken, error) {
+	r, err := c.service.Login(ctx, &pb.LoginRequest{Email: email, Password: password})
+	if err != nil {
+		return nil, err
+	}
+
+	t := &AccessToken{Token: r.Token, Account: accountFromProto(r.Account)}
+	t.ExpiresAt.UnmarshalBinary(r.ExpiresAt)
+	return t, nil
+}
+
+// VerifyToken returns the claims of a valid token, or an Unauthenticated
+// status error.
+func (c *Client) VerifyToken(ctx context.Context, token string) (*Claims, error) {
+	r, err := c.service.VerifyToken(ctx, &pb.VerifyTokenRequest{Token: token})
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{AccountID: r.AccountId, Role: Role(r.Role)}
+	claims.ExpiresAt.UnmarshalBinary(r.ExpiresAt)
+	return claims, nil
+}
+
+func (c *Client) SetAccountRole(ctx context.Context, id string, role Role) (*Account, error) {
+	r, err := c.service.SetAccountRole(ctx, &pb.SetAccountRoleRequest{Id: id, Role: string(role)})
+	if err != nil {
+		return nil, err
+	}
+	return accountFromProto(r.Account), nil
+}
+
+func (c *Client) ListAddresses(ctx context.Context, accountID string) ([]*Address, error) {
+	r, err := c.service.ListAddresses(ctx, &pb.ListAddressesRequest{AccountId: accountID})
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := []*Address{}
+	for _, a := range r.Addresses {
+		address := addressFromProto(a)
+		addresses = append(addresses, &address)
+	}
+	return addresses, nil
+}
+
+func (c *Client) GetAddress(ctx context.Context, id string) (*Address, error) {
+	r, err := c.service.GetAddress(ctx, &pb.GetAddressRequest{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	a := addressFromProto(r.Address)
+	return &a, nil
+}
+
+func (c *Client) CreateAddress(ctx context.Context, accountID string, a Address) (*Address, error) {
+	r, err := c.service.CreateAddress(ctx, &pb.CreateAddressRequest{
+		AccountId: accountID,
+		Address:   addressToProto(&a),
+	})
+	if err != nil {
+		return nil, err
+	}
+	created := addressFromProto(r.Address)
+	return &created, nil
+}
+
+// UpdateAddress replaces every field of the address with the ID of a.
+func (c *Client) UpdateAddress(ctx context.Context, a Address) (*Address, error) {
+	r, err := c.service.UpdateAddress(ctx, &pb.UpdateAddressRequest{Address: addressToProto(&a)})
+	if err != nil {
+		return nil, err
+	}
+	updated := addressFromProto(r.Address)
+	return &updated, nil
+}
+
+func (c *Client) DeleteAddress(ctx context.Context, id string) error {
+	_, err := c.service.DeleteAddress(ctx, &pb.DeleteAddressRequest{Id: id})
+	return err
+}
+
+func (c *Client) DeleteAccount(ctx context.Context, id string) error {
+	_, err := c.service.DeleteAccount(ctx, &pb.DeleteAccountRequest{Id: id})
+	return err
+}
+
+// ExportAccountData returns the JSON archive of the account's data.
+func (c *Client) ExportAccountData(ctx context.Context, id string) ([]byte, error) {
+	r, err := c.service.ExportAccountData(ctx, &pb.ExportAccountDataRequest{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	return r.Archive, nil
+}
+
+func accountFromProto(a *pb.Account) *Account {
+	acc := &Account{
+		ID:          a.Id,
+		Name:        a.Name,
+		DisplayName: a.DisplayName,
+		Email:       a.Email,
+		Phone:       a.Phone,
+		Role:        Role(a.Role),
 	}
-	return accounts, nil
+	acc.CreatedAt.UnmarshalBinary(a.CreatedAt)
+	acc.UpdatedAt.UnmarshalBinary(a.UpdatedAt)
+	return acc
 }
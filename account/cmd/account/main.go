@@ -5,12 +5,19 @@ import (
 	"time"
 
 	"github.com/jaykapade/cart-microservice/account"
+	"github.com/jaykapade/cart-microservice/notify"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/tinrab/retry"
 )
 
 type Config struct {
-	DatabaseURL string `envconfig:"DATABASE_URL"`
+	DatabaseURL string        `envconfig:"DATABASE_URL"`
+	TokenSecret string        `envconfig:"TOKEN_SECRET" required:"true"`
+	TokenTTL    time.Duration `envconfig:"TOKEN_TTL" default:"1h"`
+	OrderURL    string        `envconfig:"ORDER_SERVICE_URL"`
+	CartURL     string        `envconfig:"CART_SERVICE_URL"`
+	MailboxDir  string        `envconfig:"MAILBOX_DIR"`
+	MailFrom    string        `envconfig:"MAIL_FROM" default:"Cart <no-reply@cart.localhost>"`
 }
 
 func main() {
@@ -30,7 +37,19 @@ func main() {
 		return err
 	})
 	defer r.Close()
+
+	notifier := notify.Discard
+	if cfg.MailboxDir != "" {
+		mailbox, err := notify.NewMailbox(cfg.MailboxDir, cfg.MailFrom)
+		if err != nil {
+			log.Fatal(err)
+		}
+		queue := notify.NewQueue(mailbox, 100)
+		defer queue.Close()
+		notifier = queue
+	}
+
 	log.Println("Listening on port 8080...")
-	s := account.NewService(r)
-	log.Fatal(account.ListenGRPC(s, 8080))
+	s := account.NewService(r, []byte(cfg.TokenSecret), cfg.TokenTTL, notifier)
+	log.Fatal(account.ListenGRPC(s, cfg.OrderURL, cfg.CartURL, 8080))
 }
@@ -0,0 +1,194 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jaykapade/cart-microservice/account/pb"
+	cartpb "github.com/jaykapade/cart-microservice/cart/pb"
+	"github.com/jaykapade/cart-microservice/money"
+	orderpb "github.com/jaykapade/cart-microservice/order/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DataExport is the archive returned by ExportAccountData.
+type DataExport struct {
+	ExportedAt time.Time       `json:"exportedAt"`
+	Account    *Account        `json:"account"`
+	Addresses  []Address       `json:"addresses"`
+	Orders     []ExportedOrder `json:"orders"`
+}
+
+type ExportedOrder struct {
+	ID              string                `json:"id"`
+	CreatedAt       time.Time             `json:"createdAt"`
+	Status          string                `json:"status"`
+	TotalPrice      ExportedMoney         `json:"totalPrice"`
+	ShippingAddress *ExportedShipping     `json:"shippingAddress,omitempty"`
+	Products        []ExportedOrderLine   `json:"products"`
+	StatusHistory   []ExportedStatusEvent `json:"statusHistory"`
+}
+
+type ExportedOrderLine struct {
+	ProductID  string            `json:"productId"`
+	SKU        string            `json:"sku,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Name       string            `json:"name"`
+	Price      *ExportedMoney    `json:"price"`
+	Quantity   uint32            `json:"quantity"`
+}
+
+type ExportedShipping struct {
+	AddressID  string `json:"addressId"`
+	Recipient  string `json:"recipient"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2"`
+	City       string `json:"city"`
+	PostalCode string `json:"postalCode"`
+	Country    string `json:"country"`
+}
+
+type ExportedStatusEvent struct {
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ExportedMoney holds a decimal amount such as "12.30" with its currency.
+type ExportedMoney struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// DeleteAccount anonymizes the account's orders and empties its cart before
+// erasing the account itself, so a request that fails halfway can be retried.
+func (s *grpcServer) DeleteAccount(ctx context.Context, r *pb.DeleteAccountRequest) (*pb.DeleteAccountResponse, error) {
+	if _, err := s.service.GetAccount(ctx, r.Id); err == ErrNotFound {
+		return nil, status.Errorf(codes.NotFound, "account %s not found", r.Id)
+	} else if err != nil {
+		log.Println("Error deleting account", err)
+		return nil, errors.New("Error deleting account")
+	}
+
+	if _, err := s.orderClient.AnonymizeAccountOrders(ctx, &orderpb.AnonymizeAccountOrdersRequest{AccountId: r.Id}); err != nil {
+		log.Println("Error anonymizing orders of account", r.Id, err)
+		return nil, status.Error(codes.Unavailable, "could not anonymize the account's orders")
+	}
+	if _, err := s.cartClient.ClearCart(ctx, &cartpb.ClearCartRequest{AccountId: r.Id}); err != nil {
+		log.Println("Error clearing cart of account", r.Id, err)
+		return nil, status.Error(codes.Unavailable, "could not clear the account's cart")
+	}
+
+	err := s.service.DeleteAccount(ctx, r.Id)
+	if err == ErrNotFound {
+		return nil, status.Errorf(codes.NotFound, "account %s not found", r.Id)
+	}
+	if err != nil {
+		log.Println("Error deleting account", err)
+		return nil, errors.New("Error deleting account")
+	}
+	return &pb.DeleteAccountResponse{}, nil
+}
+
+func (s *grpcServer) ExportAccountData(ctx context.Context, r *pb.ExportAccountDataRequest) (*pb.ExportAccountDataResponse, error) {
+	a, err := s.service.GetAccount(ctx, r.Id)
+	if err == ErrNotFound {
+		return nil, status.Errorf(codes.NotFound, "account %s not found", r.Id)
+	}
+	if err != nil {
+		log.Println("Error exporting account data", err)
+		return nil, errors.New("Error exporting account data")
+	}
+
+	addresses, err := s.service.ListAddresses(ctx, r.Id)
+	if err != nil {
+		log.Println("Error exporting account data", err)
+		return nil, errors.New("Error exporting account data")
+	}
+	if addresses == nil {
+		addresses = []Address{}
+	}
+
+	orders := []ExportedOrder{}
+	after := ""
+	for {
+		res, err := s.orderClient.GetOrdersForAccount(ctx, &orderpb.GetOrdersForAccountRequest{
+			AccountId: r.Id,
+			After:     after,
+			Take:      100,
+		})
+		if err != nil {
+			log.Println("Error getting orders of account", r.Id, err)
+			return nil, status.Error(codes.Unavailable, "could not get the account's orders")
+		}
+		for _, o := range res.Orders {
+			orders = append(orders, exportOrder(o))
+		}
+		if res.NextCursor == "" {
+			break
+		}
+		after = res.NextCursor
+	}
+
+	archive, err := json.MarshalIndent(DataExport{
+		ExportedAt: time.Now().UTC(),
+		Account:    a,
+		Addresses:  addresses,
+		Orders:     orders,
+	}, "", "  ")
+	if err != nil {
+		log.Println("Error exporting account data", err)
+		return nil, errors.New("Error exporting account data")
+	}
+	return &pb.ExportAccountDataResponse{Archive: archive}, nil
+}
+
+func exportOrder(o *orderpb.Order) ExportedOrder {
+	e := ExportedOrder{
+		ID:            o.Id,
+		Status:        o.Status,
+		TotalPrice:    exportMoney(money.FromProto(o.TotalPrice)),
+		Products:      []ExportedOrderLine{},
+		StatusHistory: []ExportedStatusEvent{},
+	}
+	e.CreatedAt.UnmarshalBinary(o.CreatedAt)
+
+	if sa := o.ShippingAddress; sa != nil {
+		e.ShippingAddress = &ExportedShipping{
+			AddressID:  sa.AddressId,
+			Recipient:  sa.Recipient,
+			Line1:      sa.Line1,
+			Line2:      sa.Line2,
+			City:       sa.City,
+			PostalCode: sa.PostalCode,
+			Country:    sa.Country,
+		}
+	}
+	for _, p := range o.Products {
+		line := ExportedOrderLine{
+			ProductID:  p.Id,
+			SKU:        p.Sku,
+			Attributes: p.Attributes,
+			Name:       p.Name,
+			Quantity:   p.Quantity,
+		}
+		if p.Price != nil {
+			price := exportMoney(money.FromProto(p.Price))
+			line.Price = &price
+		}
+		e.Products = append(e.Products, line)
+	}
+	for _, c := range o.StatusHistory {
+		event := ExportedStatusEvent{Status: c.Status}
+		event.CreatedAt.UnmarshalBinary(c.CreatedAt)
+		e.StatusHistory = append(e.StatusHistory, event)
+	}
+	return e
+}
+
+func exportMoney(m money.Money) ExportedMoney {
+	return ExportedMoney{Amount: m.String(), Currency: m.Currency}
+}
@@ -0,0 +1,81 @@
+package account
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestPBKDF2(t *testing.T) {
+	tests := []struct {
+		password   string
+		salt       string
+		iterations int
+		key        string
+	}{
+		// RFC 7914, section 11.
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+
+		// The RFC 6070 inputs with HMAC-SHA256, covering keys shorter than
+		// and not a multiple of the hash size.
+		{"password", "salt", 1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{"password", "salt", 2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{"password", "salt", 4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, "348c89dbcbd32b2f32d814b8116e84cf2b17347ebc1800181c4e2a1fb8dd53e1c635518c7dac47e9"},
+		{"pass\x00word", "sa\x00lt", 4096, "89b69d0516f829893c696226650a8687"},
+	}
+
+	for _, tt := range tests {
+		want, err := hex.DecodeString(tt.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := pbkdf2([]byte(tt.password), []byte(tt.salt), tt.iterations, len(want))
+		if !bytes.Equal(got, want) {
+			t.Errorf("pbkdf2(%q, %q, %d, %d) = %x; want %x", tt.password, tt.salt, tt.iterations, len(want), got, want)
+		}
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := hashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "pbkdf2-sha256$600000$") {
+		t.Errorf("hashPassword = %q; want a pbkdf2-sha256 hash with 600000 iterations", hash)
+	}
+	if !checkPassword(hash, "correct horse") {
+		t.Error("checkPassword rejects the hashed password")
+	}
+	if checkPassword(hash, "correct horse ") {
+		t.Error("checkPassword accepts a different password")
+	}
+
+	// The RFC 7914 vector with c=1, stored as hashPassword would.
+	stored := "pbkdf2-sha256$1$c2FsdA$VawEblbjCJ/sFpHCJUS2BflBhSFt3gRl5oudV8INrLxJypzM8Xm2RZkWZLOdd+8xfHG4RbHjC9UJESBB06GXgw"
+	if !checkPassword(stored, "passwd") {
+		t.Error("checkPassword rejects a hash with other parameters")
+	}
+
+	// The first half of that key is a valid hash on its own, so each of these
+	// is rejected only for the part it breaks.
+	if !checkPassword("pbkdf2-sha256$1$c2FsdA$VawEblbjCJ/sFpHCJUS2BQ", "passwd") {
+		t.Error("checkPassword rejects a shorter key")
+	}
+	for _, hash := range []string{
+		"",
+		"pbkdf2-sha1$1$c2FsdA$VawEblbjCJ/sFpHCJUS2BQ",
+		"pbkdf2-sha256$0$c2FsdA$VawEblbjCJ/sFpHCJUS2BQ",
+		"pbkdf2-sha256$x$c2FsdA$VawEblbjCJ/sFpHCJUS2BQ",
+		"pbkdf2-sha256$1$!!$VawEblbjCJ/sFpHCJUS2BQ",
+		"pbkdf2-sha256$1$c2FsdA$!!",
+		"pbkdf2-sha256$1$c2FsdA",
+	} {
+		if checkPassword(hash, "passwd") {
+			t.Errorf("checkPassword(%q) accepts a malformed hash", hash)
+		}
+	}
+}
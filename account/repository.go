@@ -3,21 +3,59 @@ package account
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strings"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/jaykapade/cart-microservice/keyset"
+	"github.com/lib/pq"
 )
 
 type Repository interface {
 	Close()
 	GetAccountById(ctx context.Context, id string) (*Account, error)
 	PutAccount(ctx context.Context, a Account) error
-	ListAccounts(ctx context.Context, skip uint64, take uint64) ([]Account, error)
+	PutAccountWithCredentials(ctx context.Context, a Account, passwordHash string) error
+	UpdateAccount(ctx context.Context, id string, update AccountUpdate, updatedAt time.Time) (*Account, error)
+	GetCredentials(ctx context.Context, email string) (*Account, string, error)
+	SearchAccounts(ctx context.Context, filter AccountFilter, after *keyset.Cursor, take uint64) ([]Account, error)
+	UpdateRole(ctx context.Context, id string, role Role) error
+	ListAddresses(ctx context.Context, accountID string) ([]Address, error)
+	GetAddress(ctx context.Context, id string) (*Address, error)
+	PutAddress(ctx context.Context, a Address) error
+	UpdateAddress(ctx context.Context, a Address) error
+	DeleteAddress(ctx context.Context, id string) error
+	AnonymizeAccount(ctx context.Context, id string, deletedAt time.Time) error
 }
 
 type postgresRepository struct {
 	db *sql.DB
 }
 
+// accountColumns are the columns scanAccount reads, in order.
+const accountColumns = "id, name, display_name, COALESCE(email, ''), COALESCE(phone, ''), role, created_at, updated_at, deleted_at"
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAccount(row scanner, extra ...interface{}) (*Account, error) {
+	a := &Account{}
+	dest := append([]interface{}{
+		&a.ID, &a.Name, &a.DisplayName, &a.Email, &a.Phone, &a.Role, &a.CreatedAt, &a.UpdatedAt, &a.DeletedAt,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	a.CreatedAt = a.CreatedAt.UTC()
+	a.UpdatedAt = a.UpdatedAt.UTC()
+	if a.DeletedAt != nil {
+		deletedAt := a.DeletedAt.UTC()
+		a.DeletedAt = &deletedAt
+	}
+	return a, nil
+}
+
 func NewPostgresRepository(url string) (Repository, error) {
 	db, err := sql.Open("postgres", url)
 	if err != nil {
@@ -41,25 +79,166 @@ func (r *postgresRepository) Ping() error {
 }
 
 func (r *postgresRepository) GetAccountById(ctx context.Context, id string) (*Account, error) {
-	row := r.db.QueryRowContext(ctx, "SELECT id, name FROM accounts WHERE id = $1", id)
-	a := &Account{}
-	if err := row.Scan(&a.ID, &a.Name); err != nil {
+	row := r.db.QueryRowContext(ctx, "SELECT "+accountColumns+" FROM accounts WHERE id = $1", id)
+	a, err := scanAccount(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
 		return nil, err
 	}
 	return a, nil
 }
 
 func (r *postgresRepository) PutAccount(ctx context.Context, a Account) error {
-	_, err := r.db.ExecContext(ctx, "INSERT INTO accounts (id, name) VALUES ($1, $2)", a.ID, a.Name)
+	_, err := r.db.ExecContext(
+		ctx,
+		"INSERT INTO accounts (id, name, role, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)",
+		a.ID,
+		a.Name,
+		a.Role,
+		a.CreatedAt,
+		a.UpdatedAt,
+	)
+	return err
+}
+
+func (r *postgresRepository) PutAccountWithCredentials(ctx context.Context, a Account, passwordHash string) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		`INSERT INTO accounts (id, name, email, role, password_hash, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		a.ID,
+		a.Name,
+		a.Email,
+		a.Role,
+		passwordHash,
+		a.CreatedAt,
+		a.UpdatedAt,
+	)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return ErrEmailTaken
+	}
 	return err
 }
 
-func (r *postgresRepository) ListAccounts(ctx context.Context, skip uint64, take uint64) ([]Account, error) {
+// UpdateAccount sets only the profile fields present in update, so
+// concurrent updates of different fields do not overwrite each other, and
+// returns the updated account. Empty emails and phones are stored as NULL.
+// Deleted accounts are not found. The row is locked first, so an update
+// racing AnonymizeAccount either finishes before the account is anonymized or
+// finds it deleted, and never restores the erased profile.
+func (r *postgresRepository) UpdateAccount(ctx context.Context, id string, update AccountUpdate, updatedAt time.Time) (a *Account, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	var locked string
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT id FROM accounts WHERE id = $1 AND deleted_at IS NULL FOR UPDATE",
+		id,
+	).Scan(&locked)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{id}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	sets := []string{"updated_at = " + arg(updatedAt)}
+	if update.Name != nil {
+		sets = append(sets, "name = "+arg(*update.Name))
+	}
+	if update.DisplayName != nil {
+		sets = append(sets, "display_name = "+arg(*update.DisplayName))
+	}
+	if update.Email != nil {
+		sets = append(sets, fmt.Sprintf("email = NULLIF(%s, '')", arg(*update.Email)))
+	}
+	if update.Phone != nil {
+		sets = append(sets, fmt.Sprintf("phone = NULLIF(%s, '')", arg(*update.Phone)))
+	}
+
+	row := tx.QueryRowContext(
+		ctx,
+		"UPDATE accounts SET "+strings.Join(sets, ", ")+" WHERE id = $1 AND deleted_at IS NULL RETURNING "+accountColumns,
+		args...,
+	)
+	a, err = scanAccount(row)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return nil, ErrEmailTaken
+	}
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// GetCredentials returns the account registered with email and its password
+// hash.
+func (r *postgresRepository) GetCredentials(ctx context.Context, email string) (*Account, string, error) {
+	row := r.db.QueryRowContext(
+		ctx,
+		"SELECT "+accountColumns+", password_hash FROM accounts WHERE email = $1 AND password_hash IS NOT NULL",
+		email,
+	)
+	var hash string
+	a, err := scanAccount(row, &hash)
+	if err == sql.ErrNoRows {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return a, hash, nil
+}
+
+// SearchAccounts returns up to take live accounts matching filter, newest
+// first, starting after the cursor.
+func (r *postgresRepository) SearchAccounts(ctx context.Context, filter AccountFilter, after *keyset.Cursor, take uint64) ([]Account, error) {
+	conds := []string{"deleted_at IS NULL"}
+	args := []interface{}{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.Query != "" {
+		pattern := arg(prefixPattern(filter.Query))
+		conds = append(conds, fmt.Sprintf("(lower(name) LIKE %s OR email LIKE %s)", pattern, pattern))
+	}
+	if !filter.CreatedAfter.IsZero() {
+		conds = append(conds, "created_at >= "+arg(filter.CreatedAfter))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		conds = append(conds, "created_at < "+arg(filter.CreatedBefore))
+	}
+	if after != nil {
+		conds = append(conds, fmt.Sprintf("(created_at, id) < (%s, %s)", arg(after.CreatedAt), arg(after.ID)))
+	}
+
 	rows, err := r.db.QueryContext(
 		ctx,
-		"SELECT id, name FROM accounts ORDER BY id DESC OFFSET $1 LIMIT $2",
-		skip,
-		take,
+		"SELECT "+accountColumns+" FROM accounts WHERE "+strings.Join(conds, " AND ")+
+			" ORDER BY created_at DESC, id DESC LIMIT "+arg(take),
+		args...,
 	)
 	if err != nil {
 		return nil, err
@@ -68,13 +247,252 @@ func (r *postgresRepository) ListAccounts(ctx context.Context, skip uint64, take
 
 	accounts := []Account{}
 	for rows.Next() {
-		a := &Account{}
-		if err = rows.Scan(&a.ID, &a.Name); err == nil {
-			accounts = append(accounts, *a)
+		a, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
 		}
+		accounts = append(accounts, *a)
 	}
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
 	return accounts, nil
 }
+
+func (r *postgresRepository) UpdateRole(ctx context.Context, id string, role Role) error {
+	res, err := r.db.ExecContext(ctx, "UPDATE accounts SET role = $2 WHERE id = $1", id, role)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const addressColumns = `id, account_id, label, recipient, line1, line2, city, postal_code, country,
+	default_shipping, default_billing, created_at, updated_at`
+
+func scanAddress(row scanner) (*Address, error) {
+	a := &Address{}
+	err := row.Scan(
+		&a.ID,
+		&a.AccountID,
+		&a.Label,
+		&a.Recipient,
+		&a.Line1,
+		&a.Line2,
+		&a.City,
+		&a.PostalCode,
+		&a.Country,
+		&a.DefaultShipping,
+		&a.DefaultBilling,
+		&a.CreatedAt,
+		&a.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	a.CreatedAt = a.CreatedAt.UTC()
+	a.UpdatedAt = a.UpdatedAt.UTC()
+	return a, nil
+}
+
+// ListAddresses returns the account's addresses, oldest first.
+func (r *postgresRepository) ListAddresses(ctx context.Context, accountID string) ([]Address, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		"SELECT "+addressColumns+" FROM addresses WHERE account_id = $1 ORDER BY created_at, id",
+		accountID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	addresses := []Address{}
+	for rows.Next() {
+		a, err := scanAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, *a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return addresses, nil
+}
+
+func (r *postgresRepository) GetAddress(ctx context.Context, id string) (*Address, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+addressColumns+" FROM addresses WHERE id = $1", id)
+	a, err := scanAddress(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// PutAddress inserts a. If it is a default address, the account's previous
+// default loses the flag in the same transaction.
+func (r *postgresRepository) PutAddress(ctx context.Context, a Address) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	if err = clearDefaultAddresses(ctx, tx, a); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO addresses (`+addressColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		a.ID,
+		a.AccountID,
+		a.Label,
+		a.Recipient,
+		a.Line1,
+		a.Line2,
+		a.City,
+		a.PostalCode,
+		a.Country,
+		a.DefaultShipping,
+		a.DefaultBilling,
+		a.CreatedAt,
+		a.UpdatedAt,
+	)
+	return err
+}
+
+// UpdateAddress saves the fields of a. If it becomes a default address, the
+// account's previous default loses the flag in the same transaction.
+func (r *postgresRepository) UpdateAddress(ctx context.Context, a Address) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	if err = clearDefaultAddresses(ctx, tx, a); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(
+		ctx,
+		`UPDATE addresses
+		SET label = $2, recipient = $3, line1 = $4, line2 = $5, city = $6, postal_code = $7, country = $8,
+		default_shipping = $9, default_billing = $10, updated_at = $11
+		WHERE id = $1`,
+		a.ID,
+		a.Label,
+		a.Recipient,
+		a.Line1,
+		a.Line2,
+		a.City,
+		a.PostalCode,
+		a.Country,
+		a.DefaultShipping,
+		a.DefaultBilling,
+		a.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// clearDefaultAddresses removes the default flags a takes over from the
+// account's other addresses.
+func clearDefaultAddresses(ctx context.Context, tx *sql.Tx, a Address) error {
+	if a.DefaultShipping {
+		_, err := tx.ExecContext(
+			ctx,
+			"UPDATE addresses SET default_shipping = false WHERE account_id = $1 AND id <> $2 AND default_shipping",
+			a.AccountID,
+			a.ID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if a.DefaultBilling {
+		_, err := tx.ExecContext(
+			ctx,
+			"UPDATE addresses SET default_billing = false WHERE account_id = $1 AND id <> $2 AND default_billing",
+			a.AccountID,
+			a.ID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *postgresRepository) DeleteAddress(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM addresses WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AnonymizeAccount replaces the account's profile with placeholders, drops
+// its email, phone and password and deletes its addresses. Its UPDATE takes
+// the same row lock as UpdateAccount, so the two never interleave.
+func (r *postgresRepository) AnonymizeAccount(ctx context.Context, id string, deletedAt time.Time) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	res, err := tx.ExecContext(
+		ctx,
+		`UPDATE accounts
+		SET name = $2, display_name = '', email = NULL, phone = NULL, password_hash = NULL, role = $3,
+		updated_at = $4, deleted_at = COALESCE(deleted_at, $4)
+		WHERE id = $1`,
+		id,
+		DeletedAccountName,
+		RoleCustomer,
+		deletedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM addresses WHERE account_id = $1", id)
+	return err
+}
@@ -0,0 +1,27 @@
+package account
+
+type Role string
+
+const (
+	RoleCustomer Role = "customer"
+	RoleStaff    Role = "staff"
+	RoleAdmin    Role = "admin"
+)
+
+// roleRanks orders the roles; each role may do everything the roles below it
+// may.
+var roleRanks = map[Role]int{
+	RoleCustomer: 1,
+	RoleStaff:    2,
+	RoleAdmin:    3,
+}
+
+func (r Role) Valid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+// Includes reports whether r grants at least the permissions of min.
+func (r Role) Includes(min Role) bool {
+	return r.Valid() && roleRanks[r] >= roleRanks[min]
+}
@@ -0,0 +1,74 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jaykapade/cart-microservice/keyset"
+)
+
+var (
+	ErrInvalidCursor = keyset.ErrInvalidCursor
+	ErrInvalidFilter = errors.New("invalid account filter")
+)
+
+// AccountFilter narrows an account search to the accounts whose name or
+// email starts with Query, ignoring case, and that were created within the
+// given bounds. Empty fields match every account.
+type AccountFilter struct {
+	Query         string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+func (f AccountFilter) Validate() error {
+	if utf8.RuneCountInString(f.Query) > maxNameLength {
+		return ErrInvalidFilter
+	}
+	if !f.CreatedAfter.IsZero() && !f.CreatedBefore.IsZero() && f.CreatedBefore.Before(f.CreatedAfter) {
+		return ErrInvalidFilter
+	}
+	return nil
+}
+
+// SearchAccounts returns a page of the accounts matching filter, newest
+// first, and the cursor for the next page, which is empty on the last page.
+// Deleted accounts are left out.
+func (s *AccountService) SearchAccounts(ctx context.Context, filter AccountFilter, after string, take uint64) ([]Account, string, error) {
+	filter.Query = strings.TrimSpace(filter.Query)
+	if err := filter.Validate(); err != nil {
+		return nil, "", err
+	}
+	cursor, err := keyset.Decode(after)
+	if err != nil {
+		return nil, "", err
+	}
+	if take > 100 || take == 0 {
+		take = 100
+	}
+
+	accounts, err := s.repository.SearchAccounts(ctx, filter, cursor, take+1)
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if uint64(len(accounts)) > take {
+		accounts = accounts[:take]
+		last := accounts[len(accounts)-1]
+		next = keyset.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	return accounts, next, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// prefixPattern returns a LIKE pattern matching strings that start with the
+// lower-cased prefix.
+func prefixPattern(prefix string) string {
+	return likeEscaper.Replace(strings.ToLower(prefix)) + "%"
+}
@@ -3,28 +3,51 @@ package account
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net"
 
 	"github.com/jaykapade/cart-microservice/account/pb"
+	cartpb "github.com/jaykapade/cart-microservice/cart/pb"
+	orderpb "github.com/jaykapade/cart-microservice/order/pb"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 type grpcServer struct {
 	pb.UnimplementedAccountServiceServer
-	service Service
+	service     Service
+	orderClient orderpb.OrderServiceClient
+	cartClient  cartpb.CartServiceClient
 }
 
-func ListenGRPC(s Service, port int) error {
+func ListenGRPC(s Service, orderURL string, cartURL string, port int) error {
+	orderConn, err := grpc.NewClient(orderURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	cartConn, err := grpc.NewClient(cartURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		orderConn.Close()
+		return err
+	}
+
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
+		orderConn.Close()
+		cartConn.Close()
 		return err
 	}
 	serv := grpc.NewServer()
 	pb.RegisterAccountServiceServer(serv, &grpcServer{
 		UnimplementedAccountServiceServer: pb.UnimplementedAccountServiceServer{},
 		service:                           s,
+		orderClient:                       orderpb.NewOrderServiceClient(orderConn),
+		cartClient:                        cartpb.NewCartServiceClient(cartConn),
 	})
 	reflection.Register(serv)
 	return serv.Serve(lis)
@@ -32,26 +55,300 @@ func ListenGRPC(s Service, port int) error {
 
 func (s *grpcServer) PostAccount(ctx context.Context, r *pb.PostAccountRequest) (*pb.PostAccountResponse, error) {
 	a, err := s.service.PostAccount(ctx, r.Name)
+	if err == ErrInvalidName {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	if err != nil {
 		return nil, err
 	}
-	return &pb.PostAccountResponse{Account: &pb.Account{Id: a.ID, Name: a.Name}}, nil
+	return &pb.PostAccountResponse{Account: accountToProto(a)}, nil
 }
 func (s *grpcServer) GetAccount(ctx context.Context, r *pb.GetAccountRequest) (*pb.GetAccountResponse, error) {
 	a, err := s.service.GetAccount(ctx, r.Id)
+	if err == ErrNotFound {
+		return nil, status.Errorf(codes.NotFound, "account %s not found", r.Id)
+	}
 	if err != nil {
 		return nil, err
 	}
-	return &pb.GetAccountResponse{Account: &pb.Account{Id: a.ID, Name: a.Name}}, nil
+	return &pb.GetAccountResponse{Account: accountToProto(a)}, nil
 }
-func (s *grpcServer) GetAccounts(ctx context.Context, r *pb.GetAccountsRequest) (*pb.GetAccountsResponse, error) {
-	accounts, err := s.service.GetAccounts(ctx, r.Skip, r.Take)
+
+func (s *grpcServer) SearchAccounts(ctx context.Context, r *pb.SearchAccountsRequest) (*pb.SearchAccountsResponse, error) {
+	accounts, next, err := s.service.SearchAccounts(ctx, filterFromProto(r.Filter), r.After, r.Take)
+	if err == ErrInvalidCursor || err == ErrInvalidFilter {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	if err != nil {
-		return nil, err
+		log.Println("Error searching accounts", err)
+		return nil, errors.New("Error searching accounts")
 	}
+
 	accountsPb := []*pb.Account{}
 	for _, a := range accounts {
-		accountsPb = append(accountsPb, &pb.Account{Id: a.ID, Name: a.Name})
+		accountsPb = append(accountsPb, accountToProto(&a))
+	}
+	return &pb.SearchAccountsResponse{
+		Accounts:   accountsPb,
+		NextCursor: next,
+	}, nil
+}
+
+func (s *grpcServer) UpdateAccount(ctx context.Context, r *pb.UpdateAccountRequest) (*pb.UpdateAccountResponse, error) {
+	update := AccountUpdate{}
+	paths := r.UpdateMask.GetPaths()
+	if len(paths) == 0 {
+		if r.Name != "" {
+			paths = append(paths, "name")
+		}
+		if r.DisplayName != "" {
+			paths = append(paths, "displayName")
+		}
+		if r.Email != "" {
+			paths = append(paths, "email")
+		}
+		if r.Phone != "" {
+			paths = append(paths, "phone")
+		}
+	}
+	for _, path := range paths {
+		switch path {
+		case "name":
+			update.Name = &r.Name
+		case "displayName":
+			update.DisplayName = &r.DisplayName
+		case "email":
+			update.Email = &r.Email
+		case "phone":
+			update.Phone = &r.Phone
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "unknown update mask path %q", path)
+		}
+	}
+
+	a, err := s.service.UpdateAccount(ctx, r.Id, update)
+	switch err {
+	case nil:
+	case ErrNotFound:
+		return nil, status.Errorf(codes.NotFound, "account %s not found", r.Id)
+	case ErrInvalidName, ErrInvalidEmail, ErrInvalidPhone:
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case ErrEmailTaken:
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	default:
+		log.Println("Error updating account", err)
+		return nil, errors.New("Error updating account")
+	}
+	return &pb.UpdateAccountResponse{Account: accountToProto(a)}, nil
+}
+
+func (s *grpcServer) Register(ctx context.Context, r *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+	a, err := s.service.Register(ctx, r.Name, r.Email, r.Password)
+	switch err {
+	case nil:
+	case ErrInvalidEmail, ErrInvalidName:
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case ErrWeakPassword:
+		return nil, status.Errorf(codes.InvalidArgument, "password must have at least %d characters", MinPasswordLength)
+	case ErrEmailTaken:
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	default:
+		log.Println("Error registering account", err)
+		return nil, errors.New("Error registering account")
+	}
+	return &pb.RegisterResponse{Account: accountToProto(a)}, nil
+}
+
+func (s *grpcServer) Login(ctx context.Context, r *pb.LoginRequest) (*pb.LoginResponse, error) {
+	t, err := s.service.Login(ctx, r.Email, r.Password)
+	if err == ErrInvalidCredentials {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		log.Println("Error logging in", err)
+		return nil, errors.New("Error logging in")
+	}
+
+	res := &pb.LoginResponse{Token: t.Token, Account: accountToProto(t.Account)}
+	res.ExpiresAt, _ = t.ExpiresAt.MarshalBinary()
+	return res, nil
+}
+
+func (s *grpcServer) VerifyToken(ctx context.Context, r *pb.VerifyTokenRequest) (*pb.VerifyTokenResponse, error) {
+	c, err := s.service.VerifyToken(ctx, r.Token)
+	if err == ErrInvalidToken {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		log.Println("Error verifying token", err)
+		return nil, errors.New("Error verifying token")
+	}
+
+	res := &pb.VerifyTokenResponse{AccountId: c.AccountID, Role: string(c.Role)}
+	res.ExpiresAt, _ = c.ExpiresAt.MarshalBinary()
+	return res, nil
+}
+
+func (s *grpcServer) SetAccountRole(ctx context.Context, r *pb.SetAccountRoleRequest) (*pb.SetAccountRoleResponse, error) {
+	a, err := s.service.SetAccountRole(ctx, r.Id, Role(r.Role))
+	switch err {
+	case nil:
+	case ErrInvalidRole:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid role %q", r.Role)
+	case ErrNotFound:
+		return nil, status.Errorf(codes.NotFound, "account %s not found", r.Id)
+	default:
+		log.Println("Error setting account role", err)
+		return nil, errors.New("Error setting account role")
+	}
+	return &pb.SetAccountRoleResponse{Account: accountToProto(a)}, nil
+}
+
+func (s *grpcServer) ListAddresses(ctx context.Context, r *pb.ListAddressesRequest) (*pb.ListAddressesResponse, error) {
+	addresses, err := s.service.ListAddresses(ctx, r.AccountId)
+	if err != nil {
+		log.Println("Error listing addresses", err)
+		return nil, errors.New("Error listing addresses")
+	}
+
+	res := &pb.ListAddressesResponse{Addresses: []*pb.Address{}}
+	for i := range addresses {
+		res.Addresses = append(res.Addresses, addressToProto(&addresses[i]))
+	}
+	return res, nil
+}
+
+func (s *grpcServer) GetAddress(ctx context.Context, r *pb.GetAddressRequest) (*pb.GetAddressResponse, error) {
+	a, err := s.service.GetAddress(ctx, r.Id)
+	if err == ErrNotFound {
+		return nil, status.Errorf(codes.NotFound, "address %s not found", r.Id)
+	}
+	if err != nil {
+		log.Println("Error getting address", err)
+		return nil, errors.New("Error getting address")
+	}
+	return &pb.GetAddressResponse{Address: addressToProto(a)}, nil
+}
+
+func (s *grpcServer) CreateAddress(ctx context.Context, r *pb.CreateAddressRequest) (*pb.CreateAddressResponse, error) {
+	a, err := s.service.CreateAddress(ctx, r.AccountId, addressFromProto(r.Address))
+	switch {
+	case err == nil:
+	case err == ErrNotFound:
+		return nil, status.Errorf(codes.NotFound, "account %s not found", r.AccountId)
+	case errors.Is(err, ErrInvalidAddress):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	default:
+		log.Println("Error creating address", err)
+		return nil, errors.New("Error creating address")
+	}
+	return &pb.CreateAddressResponse{Address: addressToProto(a)}, nil
+}
+
+func (s *grpcServer) UpdateAddress(ctx context.Context, r *pb.UpdateAddressRequest) (*pb.UpdateAddressResponse, error) {
+	a, err := s.service.UpdateAddress(ctx, addressFromProto(r.Address))
+	switch {
+	case err == nil:
+	case err == ErrNotFound:
+		return nil, status.Errorf(codes.NotFound, "address %s not found", r.Address.GetId())
+	case errors.Is(err, ErrInvalidAddress):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	default:
+		log.Println("Error updating address", err)
+		return nil, errors.New("Error updating address")
+	}
+	return &pb.UpdateAddressResponse{Address: addressToProto(a)}, nil
+}
+
+func (s *grpcServer) DeleteAddress(ctx context.Context, r *pb.DeleteAddressRequest) (*pb.DeleteAddressResponse, error) {
+	err := s.service.DeleteAddress(ctx, r.Id)
+	if err == ErrNotFound {
+		return nil, status.Errorf(codes.NotFound, "address %s not found", r.Id)
+	}
+	if err != nil {
+		log.Println("Error deleting address", err)
+		return nil, errors.New("Error deleting address")
+	}
+	return &pb.DeleteAddressResponse{}, nil
+}
+
+func addressToProto(a *Address) *pb.Address {
+	p := &pb.Address{
+		Id:              a.ID,
+		AccountId:       a.AccountID,
+		Label:           a.Label,
+		Recipient:       a.Recipient,
+		Line1:           a.Line1,
+		Line2:           a.Line2,
+		City:            a.City,
+		PostalCode:      a.PostalCode,
+		Country:         a.Country,
+		DefaultShipping: a.DefaultShipping,
+		DefaultBilling:  a.DefaultBilling,
+	}
+	p.CreatedAt, _ = a.CreatedAt.MarshalBinary()
+	p.UpdatedAt, _ = a.UpdatedAt.MarshalBinary()
+	return p
+}
+
+func addressFromProto(p *pb.Address) Address {
+	a := Address{
+		ID:              p.GetId(),
+		AccountID:       p.GetAccountId(),
+		Label:           p.GetLabel(),
+		Recipient:       p.GetRecipient(),
+		Line1:           p.GetLine1(),
+		Line2:           p.GetLine2(),
+		City:            p.GetCity(),
+		PostalCode:      p.GetPostalCode(),
+		Country:         p.GetCountry(),
+		DefaultShipping: p.GetDefaultShipping(),
+		DefaultBilling:  p.GetDefaultBilling(),
+	}
+	a.CreatedAt.UnmarshalBinary(p.GetCreatedAt())
+	a.UpdatedAt.UnmarshalBinary(p.GetUpdatedAt())
+	return a
+}
+
+func accountToProto(a *Account) *pb.Account {
+	p := &pb.Account{
+		Id:          a.ID,
+		Name:        a.Name,
+		DisplayName: a.DisplayName,
+		Email:       a.Email,
+		Phone:       a.Phone,
+		Role:        string(a.Role),
+	}
+	p.CreatedAt, _ = a.CreatedAt.MarshalBinary()
+	p.UpdatedAt, _ = a.UpdatedAt.MarshalBinary()
+	return p
+}
+
+func filterFromProto(f *pb.AccountFilter) AccountFilter {
+	filter := AccountFilter{}
+	if f == nil {
+		return filter
+	}
+
+	filter.Query = f.Query
+	if len(f.CreatedAfter) > 0 {
+		filter.CreatedAfter.UnmarshalBinary(f.CreatedAfter)
+	}
+	if len(f.CreatedBefore) > 0 {
+		filter.CreatedBefore.UnmarshalBinary(f.CreatedBefore)
+	}
+
+	return filter
+}
+
+func filterToProto(f AccountFilter) *pb.AccountFilter {
+	fp := &pb.AccountFilter{Query: f.Query}
+	if !f.CreatedAfter.IsZero() {
+		fp.CreatedAfter, _ = f.CreatedAfter.MarshalBinary()
 	}
-	return &pb.GetAccountsResponse{Accounts: accountsPb}, nil
+	if !f.CreatedBefore.IsZero() {
+		fp.CreatedBefore, _ = f.CreatedBefore.MarshalBinary()
+	}
+
+	return fp
 }
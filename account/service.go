@@ -2,50 +2,304 @@ package account
 
 import (
 	"context"
+	"errors"
+	"log"
+	"net/mail"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
+	"github.com/jaykapade/cart-microservice/notify"
 	"github.com/segmentio/ksuid"
 )
 
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrInvalidEmail       = errors.New("invalid email")
+	ErrWeakPassword       = errors.New("password is too short")
+	ErrEmailTaken         = errors.New("email is already registered")
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrInvalidToken       = errors.New("invalid or expired token")
+	ErrInvalidRole        = errors.New("invalid role")
+	ErrInvalidName        = errors.New("name must have 1 to 100 characters")
+	ErrInvalidPhone       = errors.New("invalid phone number")
+	ErrInvalidAddress     = errors.New("invalid address")
+)
+
 type Service interface {
 	GetAccount(ctx context.Context, id string) (*Account, error)
-	GetAccounts(ctx context.Context, skip uint64, take uint64) ([]Account, error)
+	SearchAccounts(ctx context.Context, filter AccountFilter, after string, take uint64) ([]Account, string, error)
 	PostAccount(ctx context.Context, name string) (*Account, error)
-	PutAccount(ctx context.Context, a Account) error
+	UpdateAccount(ctx context.Context, id string, update AccountUpdate) (*Account, error)
+	Register(ctx context.Context, name string, email string, password string) (*Account, error)
+	Login(ctx context.Context, email string, password string) (*AccessToken, error)
+	VerifyToken(ctx context.Context, token string) (*Claims, error)
+	SetAccountRole(ctx context.Context, id string, role Role) (*Account, error)
+	ListAddresses(ctx context.Context, accountID string) ([]Address, error)
+	GetAddress(ctx context.Context, id string) (*Address, error)
+	CreateAddress(ctx context.Context, accountID string, a Address) (*Address, error)
+	UpdateAddress(ctx context.Context, a Address) (*Address, error)
+	DeleteAddress(ctx context.Context, id string) error
+	DeleteAccount(ctx context.Context, id string) error
 }
 
 type Account struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	DisplayName string     `json:"displayName"`
+	Email       string     `json:"email"`
+	Phone       string     `json:"phone"`
+	Role        Role       `json:"role"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	DeletedAt   *time.Time `json:"deletedAt,omitempty"`
+}
+
+// AccountUpdate holds the profile fields to change in an account. Nil fields
+// are left as they are; an empty Phone removes the phone number.
+type AccountUpdate struct {
+	Name        *string
+	DisplayName *string
+	Email       *string
+	Phone       *string
+}
+
+const maxNameLength = 100
+
+// DeletedAccountName replaces the name of a deleted account.
+const DeletedAccountName = "Deleted account"
+
+// AccessToken is a signed token that proves the bearer is Account until
+// ExpiresAt.
+type AccessToken struct {
+	Token     string
+	ExpiresAt time.Time
+	Account   *Account
 }
 
 type AccountService struct {
-	repository Repository
+	repository  Repository
+	tokenSecret []byte
+	tokenTTL    time.Duration
+	notifier    notify.Notifier
 }
 
-func NewService(r Repository) Service {
-	return &AccountService{r}
+// NewService returns a service that signs access tokens with tokenSecret,
+// valid for tokenTTL, and welcomes new accounts through notifier.
+func NewService(r Repository, tokenSecret []byte, tokenTTL time.Duration, notifier notify.Notifier) Service {
+	return &AccountService{
+		repository:  r,
+		tokenSecret: tokenSecret,
+		tokenTTL:    tokenTTL,
+		notifier:    notifier,
+	}
 }
 
 func (s *AccountService) GetAccount(ctx context.Context, id string) (*Account, error) {
 	return s.repository.GetAccountById(ctx, id)
 }
 
-func (s *AccountService) GetAccounts(ctx context.Context, skip uint64, take uint64) ([]Account, error) {
-	if take > 100 || (skip == 0 && take == 0) {
-		take = 100
+func (s *AccountService) PostAccount(ctx context.Context, name string) (*Account, error) {
+	if !validName(name) {
+		return nil, ErrInvalidName
 	}
-	return s.repository.ListAccounts(ctx, skip, take)
+	now := time.Now().UTC()
+	a := &Account{Name: name, ID: ksuid.New().String(), Role: RoleCustomer, CreatedAt: now, UpdatedAt: now}
+	err := s.repository.PutAccount(ctx, *a)
+	if err != nil {
+		return nil, err
+	}
+	s.notifyAccountCreated(ctx, a)
+	return a, nil
 }
 
-func (s *AccountService) PostAccount(ctx context.Context, name string) (*Account, error) {
-	a := &Account{Name: name, ID: ksuid.New().String()}
-	err := s.repository.PutAccount(ctx, *a)
+// UpdateAccount changes the profile fields set in update and leaves the
+// others as they are in the database, not as they were when read. The email
+// of an account cannot be removed, as it may be needed to log in.
+func (s *AccountService) UpdateAccount(ctx context.Context, id string, update AccountUpdate) (*Account, error) {
+	if update.Name != nil {
+		if !validName(*update.Name) {
+			return nil, ErrInvalidName
+		}
+	}
+	if update.DisplayName != nil {
+		if utf8.RuneCountInString(*update.DisplayName) > maxNameLength {
+			return nil, ErrInvalidName
+		}
+	}
+	if update.Email != nil {
+		email, err := normalizeEmail(*update.Email)
+		if err != nil {
+			return nil, err
+		}
+		update.Email = &email
+	}
+	if update.Phone != nil {
+		phone, err := normalizePhone(*update.Phone)
+		if err != nil {
+			return nil, err
+		}
+		update.Phone = &phone
+	}
+
+	return s.repository.UpdateAccount(ctx, id, update, time.Now().UTC())
+}
+
+// Register creates an account that can log in with email and password.
+// Emails are compared case-insensitively.
+func (s *AccountService) Register(ctx context.Context, name string, email string, password string) (*Account, error) {
+	if !validName(name) {
+		return nil, ErrInvalidName
+	}
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if len(password) < MinPasswordLength {
+		return nil, ErrWeakPassword
+	}
+
+	hash, err := hashPassword(password)
 	if err != nil {
 		return nil, err
 	}
+
+	now := time.Now().UTC()
+	a := &Account{
+		ID:        ksuid.New().String(),
+		Name:      name,
+		Email:     email,
+		Role:      RoleCustomer,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.repository.PutAccountWithCredentials(ctx, *a, hash); err != nil {
+		return nil, err
+	}
+	s.notifyAccountCreated(ctx, a)
 	return a, nil
 }
 
-func (s *AccountService) PutAccount(ctx context.Context, a Account) error {
-	return s.repository.PutAccount(ctx, a)
+// notifyAccountCreated queues the welcome message for a, unless a has no
+// email to send it to. Failing to do so is logged and does not fail the
+// request.
+func (s *AccountService) notifyAccountCreated(ctx context.Context, a *Account) {
+	if a.Email == "" {
+		return
+	}
+	m, err := notify.AccountCreated(notify.Recipient{AccountID: a.ID, Name: a.Name, Email: a.Email})
+	if err == nil {
+		err = s.notifier.Notify(ctx, m)
+	}
+	if err != nil {
+		log.Println("Error notifying account", a.ID, err)
+	}
+}
+
+// Login checks the credentials and issues an access token. Unknown emails
+// and wrong passwords fail alike, and take as long, so neither reveals which
+// emails are registered.
+func (s *AccountService) Login(ctx context.Context, email string, password string) (*AccessToken, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	a, hash, err := s.repository.GetCredentials(ctx, email)
+	if err == ErrNotFound {
+		checkPassword(unknownAccountHash(), password)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !checkPassword(hash, password) {
+		return nil, ErrInvalidCredentials
+	}
+
+	now := time.Now().UTC()
+	claims := Claims{AccountID: a.ID, ExpiresAt: now.Add(s.tokenTTL).Truncate(time.Second)}
+	token, err := signToken(s.tokenSecret, claims, now)
+	if err != nil {
+		return nil, err
+	}
+	return &AccessToken{Token: token, ExpiresAt: claims.ExpiresAt, Account: a}, nil
+}
+
+// VerifyToken checks the token and returns its claims with the account's
+// current role, so role changes apply to tokens that were already issued.
+func (s *AccountService) VerifyToken(ctx context.Context, token string) (*Claims, error) {
+	c, err := parseToken(s.tokenSecret, token, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := s.repository.GetAccountById(ctx, c.AccountID)
+	if err == ErrNotFound || (err == nil && a.DeletedAt != nil) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.Role = a.Role
+	return c, nil
+}
+
+func (s *AccountService) SetAccountRole(ctx context.Context, id string, role Role) (*Account, error) {
+	if !role.Valid() {
+		return nil, ErrInvalidRole
+	}
+	if err := s.repository.UpdateRole(ctx, id, role); err != nil {
+		return nil, err
+	}
+	return s.repository.GetAccountById(ctx, id)
+}
+
+// DeleteAccount erases the personal data of the account: its profile is
+// anonymized, its credentials and addresses are removed and its tokens stop
+// working. The account's ID stays reserved.
+func (s *AccountService) DeleteAccount(ctx context.Context, id string) error {
+	return s.repository.AnonymizeAccount(ctx, id, time.Now().UTC())
+}
+
+// unknownAccountHash is checked against when logging in with an unknown
+// email, so that it costs as much as a wrong password.
+var unknownAccountHash = sync.OnceValue(func() string {
+	hash, _ := hashPassword("")
+	return hash
+})
+
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || len(email) > 254 {
+		return "", ErrInvalidEmail
+	}
+	return email, nil
+}
+
+func validName(name string) bool {
+	n := utf8.RuneCountInString(strings.TrimSpace(name))
+	return n > 0 && utf8.RuneCountInString(name) <= maxNameLength
+}
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+
+// normalizePhone strips the spaces, dots, dashes and parentheses people write
+// phone numbers with, leaving an optional + and 7 to 15 digits. An empty
+// number stays empty.
+func normalizePhone(phone string) (string, error) {
+	phone = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '.', '-', '(', ')':
+			return -1
+		}
+		return r
+	}, phone)
+	if phone != "" && !phonePattern.MatchString(phone) {
+		return "", ErrInvalidPhone
+	}
+	return phone, nil
 }
@@ -0,0 +1,75 @@
+package account
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// tokenHeader is the encoded JWT header of every token. Tokens with any
+// other header are rejected, so the algorithm cannot be swapped.
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Claims is what a valid access token proves about its bearer. Role is not
+// part of the token; VerifyToken fills it in from the account.
+type Claims struct {
+	AccountID string
+	Role      Role
+	ExpiresAt time.Time
+}
+
+type tokenPayload struct {
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// signToken returns an HS256 JSON Web Token for the claims.
+func signToken(secret []byte, c Claims, now time.Time) (string, error) {
+	payload, err := json.Marshal(tokenPayload{
+		Subject:   c.AccountID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: c.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + tokenSignature(secret, unsigned), nil
+}
+
+// parseToken checks the token's signature and expiry and returns its claims.
+func parseToken(secret []byte, token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return nil, ErrInvalidToken
+	}
+	expected := tokenSignature(secret, parts[0]+"."+parts[1])
+	if !hmac.Equal([]byte(parts[2]), []byte(expected)) {
+		return nil, ErrInvalidToken
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	p := tokenPayload{}
+	if err := json.Unmarshal(data, &p); err != nil || p.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	expiresAt := time.Unix(p.ExpiresAt, 0).UTC()
+	if !now.Before(expiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	return &Claims{AccountID: p.Subject, ExpiresAt: expiresAt}, nil
+}
+
+func tokenSignature(secret []byte, unsigned string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,74 @@
+package account
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testSecret = []byte("test secret")
+	testNow    = time.Date(2024, time.March, 5, 14, 30, 0, 0, time.UTC)
+)
+
+func TestTokenRoundTrip(t *testing.T) {
+	token, err := signToken(testSecret, Claims{AccountID: "acc1", Role: RoleAdmin, ExpiresAt: testNow.Add(time.Hour)}, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := parseToken(testSecret, token, testNow.Add(59*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The role is not carried in the token.
+	want := Claims{AccountID: "acc1", ExpiresAt: testNow.Add(time.Hour)}
+	if *c != want {
+		t.Errorf("parseToken = %+v; want %+v", *c, want)
+	}
+}
+
+func TestParseTokenRejects(t *testing.T) {
+	token, err := signToken(testSecret, Claims{AccountID: "acc1", ExpiresAt: testNow.Add(time.Hour)}, testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+	// resign signs a header and payload the way an attacker who knows the
+	// secret would, to show the rejection is not only the signature.
+	resign := func(header string, payload string) string {
+		unsigned := header + "." + payload
+		return unsigned + "." + tokenSignature(testSecret, unsigned)
+	}
+
+	tests := []struct {
+		name   string
+		secret []byte
+		token  string
+		now    time.Time
+	}{
+		{"tampered payload", testSecret, parts[0] + "." + encode(`{"sub":"acc2","iat":1709649000,"exp":1709652600}`) + "." + parts[2], testNow},
+		{"tampered signature", testSecret, parts[0] + "." + parts[1] + "." + encode("not the signature"), testNow},
+		{"missing signature", testSecret, parts[0] + "." + parts[1] + ".", testNow},
+		{"alg none", testSecret, encode(`{"alg":"none","typ":"JWT"}`) + "." + parts[1] + ".", testNow},
+		{"alg swap", testSecret, resign(encode(`{"alg":"HS512","typ":"JWT"}`), parts[1]), testNow},
+		{"header reordered", testSecret, resign(encode(`{"typ":"JWT","alg":"HS256"}`), parts[1]), testNow},
+		{"no subject", testSecret, resign(parts[0], encode(`{"iat":1709649000,"exp":1709652600}`)), testNow},
+		{"malformed payload", testSecret, resign(parts[0], encode(`{"sub":`)), testNow},
+		{"expired", testSecret, token, testNow.Add(time.Hour)},
+		{"long expired", testSecret, token, testNow.Add(24 * time.Hour)},
+		{"wrong secret", []byte("other secret"), token, testNow},
+		{"too few parts", testSecret, parts[0] + "." + parts[1], testNow},
+		{"too many parts", testSecret, token + "." + parts[2], testNow},
+	}
+
+	for _, tt := range tests {
+		if c, err := parseToken(tt.secret, tt.token, tt.now); err != ErrInvalidToken {
+			t.Errorf("%s: parseToken = %+v, %v; want %v", tt.name, c, err, ErrInvalidToken)
+		}
+	}
+}
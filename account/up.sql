@@ -2,3 +2,37 @@ CREATE TABLE IF NOT EXISTS accounts (
   id CHAR(27) PRIMARY KEY,
   name VARCHAR(24) NOT NULL
 );
+
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS email VARCHAR(254) UNIQUE;
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS password_hash TEXT;
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'customer';
+ALTER TABLE accounts ALTER COLUMN name TYPE VARCHAR(100);
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS display_name VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS phone VARCHAR(16);
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS accounts_created_at_idx ON accounts (created_at, id);
+CREATE INDEX IF NOT EXISTS accounts_name_prefix_idx ON accounts (lower(name) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS accounts_email_prefix_idx ON accounts (email text_pattern_ops);
+
+CREATE TABLE IF NOT EXISTS addresses (
+  id CHAR(27) PRIMARY KEY,
+  account_id CHAR(27) NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+  label VARCHAR(50) NOT NULL DEFAULT '',
+  recipient VARCHAR(100) NOT NULL,
+  line1 VARCHAR(100) NOT NULL,
+  line2 VARCHAR(100) NOT NULL DEFAULT '',
+  city VARCHAR(100) NOT NULL,
+  postal_code VARCHAR(16) NOT NULL DEFAULT '',
+  country CHAR(2) NOT NULL,
+  default_shipping BOOLEAN NOT NULL DEFAULT false,
+  default_billing BOOLEAN NOT NULL DEFAULT false,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS addresses_account_id_idx ON addresses (account_id, created_at);
+CREATE UNIQUE INDEX IF NOT EXISTS addresses_default_shipping_idx ON addresses (account_id) WHERE default_shipping;
+CREATE UNIQUE INDEX IF NOT EXISTS addresses_default_billing_idx ON addresses (account_id) WHERE default_billing;
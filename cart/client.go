@@ -0,0 +1,115 @@
+package cart
+
+import (
+	"context"
+	"time"
+
+	"github.com/jaykapade/cart-microservice/cart/pb"
+	"github.com/jaykapade/cart-microservice/money"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type Client struct {
+	conn    *grpc.ClientConn
+	service pb.CartServiceClient
+}
+
+func NewClient(url string) (*Client, error) {
+	conn, err := grpc.NewClient(url, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	c := pb.NewCartServiceClient(conn)
+	return &Client{conn, c}, nil
+}
+
+func (c *Client) Close() {
+	c.conn.Close()
+}
+
+func (c *Client) GetCart(ctx context.Context, accountID string) (*Cart, error) {
+	r, err := c.service.GetCart(ctx, &pb.GetCartRequest{AccountId: accountID})
+	if err != nil {
+		return nil, err
+	}
+	return cartFromProto(r.Cart), nil
+}
+
+func (c *Client) AddItem(ctx context.Context, accountID string, productID string, sku string, quantity uint32) (*Cart, error) {
+	r, err := c.service.AddItem(ctx, &pb.AddItemRequest{
+		AccountId: accountID,
+		ProductId: productID,
+		Sku:       sku,
+		Quantity:  quantity,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cartFromProto(r.Cart), nil
+}
+
+func (c *Client) UpdateItem(ctx context.Context, accountID string, productID string, sku string, quantity uint32) (*Cart, error) {
+	r, err := c.service.UpdateItem(ctx, &pb.UpdateItemRequest{
+		AccountId: accountID,
+		ProductId: productID,
+		Sku:       sku,
+		Quantity:  quantity,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cartFromProto(r.Cart), nil
+}
+
+func (c *Client) RemoveItem(ctx context.Context, accountID string, productID string, sku string) (*Cart, error) {
+	r, err := c.service.RemoveItem(ctx, &pb.RemoveItemRequest{
+		AccountId: accountID,
+		ProductId: productID,
+		Sku:       sku,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cartFromProto(r.Cart), nil
+}
+
+// Checkout places an order for the cart and returns the new order's ID.
+func (c *Client) Checkout(ctx context.Context, accountID string, shippingAddressID string, idempotencyKey string) (string, error) {
+	r, err := c.service.Checkout(ctx, &pb.CheckoutRequest{
+		AccountId:         accountID,
+		IdempotencyKey:    idempotencyKey,
+		ShippingAddressId: shippingAddressID,
+	})
+	if err != nil {
+		return "", err
+	}
+	return r.OrderId, nil
+}
+
+// ClearCart removes every item from the account's cart.
+func (c *Client) ClearCart(ctx context.Context, accountID string) error {
+	_, err := c.service.ClearCart(ctx, &pb.ClearCartRequest{AccountId: accountID})
+	return err
+}
+
+func cartFromProto(cartProto *pb.Cart) *Cart {
+	cart := &Cart{
+		AccountID: cartProto.AccountId,
+		Items:     []*Item{},
+	}
+	for _, itemProto := range cartProto.Items {
+		item := &Item{
+			ProductID: itemProto.ProductId,
+			SKU:       itemProto.Sku,
+			Name:      itemProto.Name,
+			Price:     money.FromProto(itemProto.Price),
+			Quantity:  itemProto.Quantity,
+		}
+		item.AddedAt = time.Time{}
+		item.AddedAt.UnmarshalBinary(itemProto.AddedAt)
+		cart.Items = append(cart.Items, item)
+	}
+
+	return cart
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/jaykapade/cart-microservice/cart"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/tinrab/retry"
+)
+
+type Config struct {
+	DatabaseURL string `envconfig:"DATABASE_URL"`
+	CatalogURL  string `envconfig:"CATALOG_SERVICE_URL"`
+	OrderURL    string `envconfig:"ORDER_SERVICE_URL"`
+}
+
+func main() {
+	var cfg Config
+	if err := envconfig.Process("", &cfg); err != nil {
+		log.Fatal(err)
+	}
+
+	var r cart.Repository
+	retry.ForeverSleep(2*time.Second, func(_ int) error {
+		var err error
+		r, err = cart.NewPostgresRepository(cfg.DatabaseURL)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+		log.Println("Connection to postgres successful...", cfg.DatabaseURL)
+		return nil
+	})
+	defer r.Close()
+	log.Println("Listening on port 8080...")
+	s := cart.NewCartService(r)
+	log.Fatal(cart.ListenGRPC(s, cfg.CatalogURL, cfg.OrderURL, 8080))
+}
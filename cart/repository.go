@@ -0,0 +1,237 @@
+package cart
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	_ "github.com/lib/pq"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+)
+
+type Repository interface {
+	Close()
+	GetCart(ctx context.Context, accountID string) (*Cart, error)
+	AddItem(ctx context.Context, accountID string, item *Item) error
+	UpdateItem(ctx context.Context, accountID string, item *Item) error
+	RemoveItem(ctx context.Context, accountID string, productID string, sku string) error
+	ClearCart(ctx context.Context, accountID string) error
+	GetCheckout(ctx context.Context, accountID string, idempotencyKey string) (string, error)
+	CompleteCheckout(ctx context.Context, accountID string, idempotencyKey string, orderID string, items []*Item) error
+}
+
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(url string) (Repository, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Ping()
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresRepository{db: db}, nil
+}
+
+func (r *PostgresRepository) Close() {
+	r.db.Close()
+}
+
+func (r *PostgresRepository) GetCart(ctx context.Context, accountID string) (*Cart, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`SELECT product_id, sku, name, price, currency, quantity, added_at
+		FROM cart_items
+		WHERE account_id = $1
+		ORDER BY added_at, product_id, sku`,
+		accountID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	c := &Cart{AccountID: accountID, Items: []*Item{}}
+	for rows.Next() {
+		i := &Item{}
+		err := rows.Scan(
+			&i.ProductID,
+			&i.SKU,
+			&i.Name,
+			&i.Price.Amount,
+			&i.Price.Currency,
+			&i.Quantity,
+			&i.AddedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		c.Items = append(c.Items, i)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (r *PostgresRepository) AddItem(ctx context.Context, accountID string, item *Item) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		`INSERT INTO cart_items (account_id, product_id, sku, name, price, currency, quantity, added_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (account_id, product_id, sku) DO UPDATE SET
+		name = EXCLUDED.name,
+		price = EXCLUDED.price,
+		currency = EXCLUDED.currency,
+		quantity = cart_items.quantity + EXCLUDED.quantity`,
+		accountID,
+		item.ProductID,
+		item.SKU,
+		item.Name,
+		item.Price.Amount,
+		item.Price.Currency,
+		item.Quantity,
+		item.AddedAt,
+	)
+	return err
+}
+
+func (r *PostgresRepository) UpdateItem(ctx context.Context, accountID string, item *Item) error {
+	res, err := r.db.ExecContext(
+		ctx,
+		`UPDATE cart_items SET name = $1, price = $2, currency = $3, quantity = $4
+		WHERE account_id = $5 AND product_id = $6 AND sku = $7`,
+		item.Name,
+		item.Price.Amount,
+		item.Price.Currency,
+		item.Quantity,
+		accountID,
+		item.ProductID,
+		item.SKU,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PostgresRepository) RemoveItem(ctx context.Context, accountID string, productID string, sku string) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		"DELETE FROM cart_items WHERE account_id = $1 AND product_id = $2 AND sku = $3",
+		accountID,
+		productID,
+		sku,
+	)
+	return err
+}
+
+// ClearCart deletes the account's cart items and the checkouts recorded for
+// its idempotency keys.
+func (r *PostgresRepository) ClearCart(ctx context.Context, accountID string) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM cart_items WHERE account_id = $1", accountID); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM cart_checkouts WHERE account_id = $1", accountID)
+	return err
+}
+
+func (r *PostgresRepository) GetCheckout(ctx context.Context, accountID string, idempotencyKey string) (string, error) {
+	var orderID string
+	err := r.db.QueryRowContext(
+		ctx,
+		"SELECT order_id FROM cart_checkouts WHERE account_id = $1 AND idempotency_key = $2",
+		accountID,
+		idempotencyKey,
+	).Scan(&orderID)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return orderID, err
+}
+
+// CompleteCheckout records the checkout, unless its key is empty, and takes
+// each item's checked-out quantity off its line, deleting lines that reach
+// zero, in one transaction.
+func (r *PostgresRepository) CompleteCheckout(ctx context.Context, accountID string, idempotencyKey string, orderID string, items []*Item) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	if idempotencyKey != "" {
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO cart_checkouts (account_id, idempotency_key, order_id)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (account_id, idempotency_key) DO NOTHING`,
+			accountID,
+			idempotencyKey,
+			orderID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, i := range items {
+		_, err = tx.ExecContext(
+			ctx,
+			`DELETE FROM cart_items
+			WHERE account_id = $1 AND product_id = $2 AND sku = $3 AND quantity <= $4`,
+			accountID,
+			i.ProductID,
+			i.SKU,
+			i.Quantity,
+		)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(
+			ctx,
+			`UPDATE cart_items SET quantity = quantity - $4
+			WHERE account_id = $1 AND product_id = $2 AND sku = $3 AND quantity > $4`,
+			accountID,
+			i.ProductID,
+			i.SKU,
+			i.Quantity,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,316 @@
+package cart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/jaykapade/cart-microservice/cart/pb"
+	"github.com/jaykapade/cart-microservice/catalog"
+	"github.com/jaykapade/cart-microservice/money"
+	"github.com/jaykapade/cart-microservice/order"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+type grpcServer struct {
+	pb.UnimplementedCartServiceServer
+	service       Service
+	catalogClient *catalog.Client
+	orderClient   *order.Client
+}
+
+func ListenGRPC(s Service, catalogURL string, orderURL string, port int) error {
+	catalogClient, err := catalog.NewClient(catalogURL)
+	if err != nil {
+		return err
+	}
+	orderClient, err := order.NewClient(orderURL)
+	if err != nil {
+		catalogClient.Close()
+		return err
+	}
+
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		orderClient.Close()
+		catalogClient.Close()
+		return err
+	}
+
+	serv := grpc.NewServer()
+
+	pb.RegisterCartServiceServer(serv, &grpcServer{
+		UnimplementedCartServiceServer: pb.UnimplementedCartServiceServer{},
+		service:                        s,
+		catalogClient:                  catalogClient,
+		orderClient:                    orderClient,
+	})
+
+	reflection.Register(serv)
+	return serv.Serve(lis)
+}
+
+func (s *grpcServer) GetCart(ctx context.Context, r *pb.GetCartRequest) (*pb.GetCartResponse, error) {
+	c, err := s.service.GetCart(ctx, r.AccountId)
+	if err != nil {
+		log.Println("Error getting cart", err)
+		return nil, errors.New("Error getting cart")
+	}
+
+	c, _, err = s.refreshCart(ctx, c)
+	if err != nil {
+		log.Println("Error refreshing cart", err)
+		return nil, errors.New("Error refreshing cart")
+	}
+
+	return &pb.GetCartResponse{Cart: cartToProto(c)}, nil
+}
+
+func (s *grpcServer) AddItem(ctx context.Context, r *pb.AddItemRequest) (*pb.AddItemResponse, error) {
+	p, err := s.catalogClient.GetProduct(ctx, r.ProductId)
+	if status.Code(err) == codes.NotFound {
+		return nil, status.Errorf(codes.NotFound, "product %s not found", r.ProductId)
+	}
+	if err != nil {
+		log.Println("Error getting product", err)
+		return nil, errors.New("Error getting product")
+	}
+	price, err := priceOf(p, r.Sku)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	c, err := s.service.AddItem(ctx, r.AccountId, Item{
+		ProductID: p.ID,
+		SKU:       r.Sku,
+		Name:      p.Name,
+		Price:     price,
+		Quantity:  r.Quantity,
+	})
+	if err == ErrInvalidQuantity {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		log.Println("Error adding item", err)
+		return nil, errors.New("Error adding item")
+	}
+
+	return &pb.AddItemResponse{Cart: cartToProto(c)}, nil
+}
+
+func (s *grpcServer) UpdateItem(ctx context.Context, r *pb.UpdateItemRequest) (*pb.UpdateItemResponse, error) {
+	item := Item{ProductID: r.ProductId, SKU: r.Sku, Quantity: r.Quantity}
+	if r.Quantity > 0 {
+		p, err := s.catalogClient.GetProduct(ctx, r.ProductId)
+		if status.Code(err) == codes.NotFound {
+			return nil, status.Errorf(codes.NotFound, "product %s not found", r.ProductId)
+		}
+		if err != nil {
+			log.Println("Error getting product", err)
+			return nil, errors.New("Error getting product")
+		}
+		price, err := priceOf(p, r.Sku)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		item.Name = p.Name
+		item.Price = price
+	}
+
+	c, err := s.service.UpdateItem(ctx, r.AccountId, item)
+	if err == ErrNotFound {
+		return nil, status.Errorf(codes.NotFound, "product %s is not in the cart", r.ProductId)
+	}
+	if err != nil {
+		log.Println("Error updating item", err)
+		return nil, errors.New("Error updating item")
+	}
+
+	return &pb.UpdateItemResponse{Cart: cartToProto(c)}, nil
+}
+
+func (s *grpcServer) RemoveItem(ctx context.Context, r *pb.RemoveItemRequest) (*pb.RemoveItemResponse, error) {
+	c, err := s.service.RemoveItem(ctx, r.AccountId, r.ProductId, r.Sku)
+	if err != nil {
+		log.Println("Error removing item", err)
+		return nil, errors.New("Error removing item")
+	}
+
+	return &pb.RemoveItemResponse{Cart: cartToProto(c)}, nil
+}
+
+// Checkout places an order for the refreshed cart and takes the ordered items
+// out of it. The idempotency key is passed on to the order service so retried
+// checkouts do not create duplicate orders, and a retry after the cart has
+// been emptied gets the order the first attempt placed.
+func (s *grpcServer) Checkout(ctx context.Context, r *pb.CheckoutRequest) (*pb.CheckoutResponse, error) {
+	if r.IdempotencyKey != "" {
+		orderID, err := s.service.GetCheckout(ctx, r.AccountId, r.IdempotencyKey)
+		if err == nil {
+			return &pb.CheckoutResponse{OrderId: orderID}, nil
+		}
+		if err != ErrNotFound {
+			log.Println("Error getting checkout", err)
+			return nil, errors.New("Error getting checkout")
+		}
+	}
+
+	c, err := s.service.GetCart(ctx, r.AccountId)
+	if err != nil {
+		log.Println("Error getting cart", err)
+		return nil, errors.New("Error getting cart")
+	}
+
+	c, removed, err := s.refreshCart(ctx, c)
+	if err != nil {
+		log.Println("Error refreshing cart", err)
+		return nil, errors.New("Error refreshing cart")
+	}
+	if len(removed) > 0 {
+		names := []string{}
+		for _, i := range removed {
+			name := i.Name
+			if i.SKU != "" {
+				name = fmt.Sprintf("%s (%s)", i.Name, i.SKU)
+			}
+			names = append(names, name)
+		}
+		return nil, status.Errorf(codes.FailedPrecondition, "%s: %s", ErrItemsUnavailable, strings.Join(names, ", "))
+	}
+	if len(c.Items) == 0 {
+		return nil, status.Error(codes.FailedPrecondition, ErrEmptyCart.Error())
+	}
+
+	products := []*order.OrderedProduct{}
+	for _, i := range c.Items {
+		products = append(products, &order.OrderedProduct{
+			ID:       i.ProductID,
+			SKU:      i.SKU,
+			Quantity: i.Quantity,
+		})
+	}
+
+	o, err := s.orderClient.PostOrder(ctx, r.AccountId, r.ShippingAddressId, products, r.IdempotencyKey)
+	if err != nil {
+		log.Println("Error posting order", err)
+		return nil, err
+	}
+
+	if err := s.service.CompleteCheckout(ctx, r.AccountId, r.IdempotencyKey, o.ID, c.Items); err != nil {
+		log.Println("Error completing checkout", err)
+	}
+
+	return &pb.CheckoutResponse{OrderId: o.ID}, nil
+}
+
+// ClearCart empties the account's cart, as when the account is erased.
+func (s *grpcServer) ClearCart(ctx context.Context, r *pb.ClearCartRequest) (*pb.ClearCartResponse, error) {
+	if err := s.service.ClearCart(ctx, r.AccountId); err != nil {
+		log.Println("Error clearing cart", err)
+		return nil, errors.New("Error clearing cart")
+	}
+	return &pb.ClearCartResponse{}, nil
+}
+
+// refreshCart brings item names and prices up to date with the catalog and
+// drops items whose product or variant no longer exists or is inactive,
+// returning the dropped items alongside the refreshed cart.
+func (s *grpcServer) refreshCart(ctx context.Context, c *Cart) (*Cart, []*Item, error) {
+	if len(c.Items) == 0 {
+		return c, nil, nil
+	}
+
+	productIDs := []string{}
+	for _, i := range c.Items {
+		productIDs = append(productIDs, i.ProductID)
+	}
+
+	products, err := s.catalogClient.GetProducts(ctx, 0, 0, productIDs, "", catalog.ProductFilter{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	productMap := map[string]*catalog.Product{}
+	for _, p := range products {
+		productMap[p.ID] = p
+	}
+
+	changed := false
+	removed := []*Item{}
+	for _, i := range c.Items {
+		p, ok := productMap[i.ProductID]
+		var price money.Money
+		if ok {
+			price, err = priceOf(p, i.SKU)
+			ok = err == nil
+		}
+		if !ok {
+			if _, err := s.service.RemoveItem(ctx, c.AccountID, i.ProductID, i.SKU); err != nil {
+				return nil, nil, err
+			}
+			removed = append(removed, i)
+			changed = true
+			continue
+		}
+		if p.Name != i.Name || price != i.Price {
+			i.Name = p.Name
+			i.Price = price
+			if _, err := s.service.UpdateItem(ctx, c.AccountID, *i); err != nil {
+				return nil, nil, err
+			}
+			changed = true
+		}
+	}
+
+	if !changed {
+		return c, removed, nil
+	}
+	c, err = s.service.GetCart(ctx, c.AccountID)
+	return c, removed, err
+}
+
+// priceOf returns what the product sells for as the variant with the given
+// SKU. A product with variants can only be bought as one of its active
+// variants, as the order service checks again at checkout.
+func priceOf(p *catalog.Product, sku string) (money.Money, error) {
+	if sku == "" && len(p.Variants) == 0 {
+		return p.Price, nil
+	}
+	v := p.Variant(sku)
+	if v == nil || !v.Active {
+		return money.Money{}, catalog.ErrInvalidVariant
+	}
+	return p.PriceOf(v), nil
+}
+
+func cartToProto(c *Cart) *pb.Cart {
+	cp := &pb.Cart{
+		AccountId: c.AccountID,
+		Items:     []*pb.CartItem{},
+	}
+
+	for _, i := range c.Items {
+		ip := &pb.CartItem{
+			ProductId: i.ProductID,
+			Sku:       i.SKU,
+			Name:      i.Name,
+			Price:     money.ToProto(i.Price),
+			Quantity:  i.Quantity,
+		}
+		ip.AddedAt, _ = i.AddedAt.MarshalBinary()
+		cp.Items = append(cp.Items, ip)
+	}
+
+	// A cart mixing currencies has no single total.
+	if total, err := c.TotalPrice(); err == nil {
+		cp.TotalPrice = money.ToProto(total)
+	}
+
+	return cp
+}
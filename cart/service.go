@@ -0,0 +1,124 @@
+package cart
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jaykapade/cart-microservice/money"
+)
+
+var (
+	ErrInvalidQuantity = errors.New("invalid quantity")
+	ErrEmptyCart       = errors.New("cart is empty")
+	// ErrItemsUnavailable is returned by checkout when items were dropped
+	// from the cart because their product or variant is gone or inactive.
+	ErrItemsUnavailable = errors.New("cart items are no longer available")
+)
+
+type Service interface {
+	GetCart(ctx context.Context, accountID string) (*Cart, error)
+	AddItem(ctx context.Context, accountID string, item Item) (*Cart, error)
+	UpdateItem(ctx context.Context, accountID string, item Item) (*Cart, error)
+	RemoveItem(ctx context.Context, accountID string, productID string, sku string) (*Cart, error)
+	ClearCart(ctx context.Context, accountID string) error
+	GetCheckout(ctx context.Context, accountID string, idempotencyKey string) (string, error)
+	CompleteCheckout(ctx context.Context, accountID string, idempotencyKey string, orderID string, items []*Item) error
+}
+
+type Cart struct {
+	AccountID string
+	Items     []*Item
+}
+
+// Item is a product in a cart. SKU names the variant, and is empty for
+// products without variants. Name and Price are copied from the catalog and
+// refreshed whenever the cart is read.
+type Item struct {
+	ProductID string
+	SKU       string
+	Name      string
+	Price     money.Money
+	Quantity  uint32
+	AddedAt   time.Time
+}
+
+// TotalPrice sums the line totals of the cart. It fails with
+// money.ErrCurrencyMismatch if items are priced in different currencies.
+func (c *Cart) TotalPrice() (money.Money, error) {
+	total := money.Zero(money.DefaultCurrency)
+	if len(c.Items) > 0 {
+		total = money.Zero(c.Items[0].Price.Currency)
+	}
+	for _, i := range c.Items {
+		line, err := i.Price.Mul(i.Quantity)
+		if err != nil {
+			return money.Money{}, err
+		}
+		total, err = total.Add(line)
+		if err != nil {
+			return money.Money{}, err
+		}
+	}
+	return total, nil
+}
+
+type CartService struct {
+	repository Repository
+}
+
+func NewCartService(r Repository) *CartService {
+	return &CartService{repository: r}
+}
+
+func (s *CartService) GetCart(ctx context.Context, accountID string) (*Cart, error) {
+	return s.repository.GetCart(ctx, accountID)
+}
+
+// AddItem puts the item in the cart, adding to the quantity already there.
+func (s *CartService) AddItem(ctx context.Context, accountID string, item Item) (*Cart, error) {
+	if item.Quantity == 0 {
+		return nil, ErrInvalidQuantity
+	}
+	item.AddedAt = time.Now().UTC()
+	if err := s.repository.AddItem(ctx, accountID, &item); err != nil {
+		return nil, err
+	}
+	return s.repository.GetCart(ctx, accountID)
+}
+
+// UpdateItem replaces the quantity, name and price of an item already in the
+// cart. A zero quantity removes the item.
+func (s *CartService) UpdateItem(ctx context.Context, accountID string, item Item) (*Cart, error) {
+	if item.Quantity == 0 {
+		return s.RemoveItem(ctx, accountID, item.ProductID, item.SKU)
+	}
+	if err := s.repository.UpdateItem(ctx, accountID, &item); err != nil {
+		return nil, err
+	}
+	return s.repository.GetCart(ctx, accountID)
+}
+
+func (s *CartService) RemoveItem(ctx context.Context, accountID string, productID string, sku string) (*Cart, error) {
+	if err := s.repository.RemoveItem(ctx, accountID, productID, sku); err != nil {
+		return nil, err
+	}
+	return s.repository.GetCart(ctx, accountID)
+}
+
+func (s *CartService) ClearCart(ctx context.Context, accountID string) error {
+	return s.repository.ClearCart(ctx, accountID)
+}
+
+// GetCheckout returns the ID of the order a checkout with the idempotency key
+// placed, or ErrNotFound.
+func (s *CartService) GetCheckout(ctx context.Context, accountID string, idempotencyKey string) (string, error) {
+	return s.repository.GetCheckout(ctx, accountID, idempotencyKey)
+}
+
+// CompleteCheckout records the order placed for the idempotency key and takes
+// the checked-out quantities out of the cart. Items added to the cart while
+// the order was being placed stay in it.
+func (s *CartService) CompleteCheckout(ctx context.Context, accountID string, idempotencyKey string, orderID string, items []*Item) error {
+	return s.repository.CompleteCheckout(ctx, accountID, idempotencyKey, orderID, items)
+}
@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS cart_items (
+    account_id CHAR(27) NOT NULL,
+    product_id CHAR(27) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    price BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    added_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (account_id, product_id)
+);
+
+-- Items name the variant in the cart; products without variants use ''.
+ALTER TABLE cart_items ADD COLUMN IF NOT EXISTS sku VARCHAR(64) NOT NULL DEFAULT '';
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_constraint c
+        JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = ANY (c.conkey)
+        WHERE c.conrelid = 'cart_items'::regclass AND c.contype = 'p' AND a.attname = 'sku'
+    ) THEN
+        ALTER TABLE cart_items DROP CONSTRAINT IF EXISTS cart_items_pkey;
+        ALTER TABLE cart_items ADD PRIMARY KEY (account_id, product_id, sku);
+    END IF;
+END
+$$;
+
+-- Checkouts remember the order placed for each idempotency key, so that a
+-- retried checkout finds it after the cart has been emptied.
+CREATE TABLE IF NOT EXISTS cart_checkouts (
+    account_id CHAR(27) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    order_id CHAR(27) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (account_id, idempotency_key)
+);
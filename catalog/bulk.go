@@ -0,0 +1,120 @@
+package catalog
+
+import (
+	"context"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+// ImportBatchSize is how many rows of an import go into one bulk request.
+const ImportBatchSize = 500
+
+// ImportResult is the outcome of importing one product. Err is set if the
+// row was rejected; the other rows of the batch are unaffected.
+type ImportResult struct {
+	ID      string
+	Created bool
+	Err     error
+}
+
+// ImportSummary totals an import. Errors lists the failed rows, counted
+// from 1 in the order they were sent.
+type ImportSummary struct {
+	Created int
+	Updated int
+	Failed  int
+	Errors  []ImportError
+}
+
+type ImportError struct {
+	Row     int
+	ID      string
+	Message string
+}
+
+// Add counts the results of a batch whose first row is firstRow.
+func (s *ImportSummary) Add(firstRow int, results []ImportResult) {
+	for i, r := range results {
+		switch {
+		case r.Err != nil:
+			s.Failed++
+			s.Errors = append(s.Errors, ImportError{Row: firstRow + i, ID: r.ID, Message: r.Err.Error()})
+		case r.Created:
+			s.Created++
+		default:
+			s.Updated++
+		}
+	}
+}
+
+// ImportProducts creates or replaces the products in bulk. Products without
+// an ID are given one. The results are in the order of products, and rows
+// that fail validation are reported without being written.
+func (s *CatalogService) ImportProducts(ctx context.Context, products []*Product) ([]ImportResult, error) {
+	categories, err := s.categoriesByID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	results := make([]ImportResult, len(products))
+	valid := []*Product{}
+	index := []int{}
+	for i, p := range products {
+		if p.ID == "" {
+			p.ID = ksuid.New().String()
+		}
+		results[i].ID = p.ID
+
+		if !validPrice(p.Price) {
+			results[i].Err = ErrInvalidPrice
+			continue
+		}
+		if err := validateVariants(p.Price, p.Variants); err != nil {
+			results[i].Err = err
+			continue
+		}
+		if p.CategoryPath, err = pathOf(p.CategoryIDs, categories); err != nil {
+			results[i].Err = err
+			continue
+		}
+		p.CreatedAt = now
+
+		valid = append(valid, p)
+		index = append(index, i)
+	}
+	if len(valid) == 0 {
+		return results, nil
+	}
+
+	written, err := s.repository.ImportProducts(ctx, valid)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range written {
+		results[index[i]] = r
+	}
+	return results, nil
+}
+
+// ExportProducts calls fn with every product matching the filter, with its
+// available quantity, until fn returns an error.
+func (s *CatalogService) ExportProducts(ctx context.Context, filter ProductFilter, fn func(*Product) error) error {
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+
+	return s.repository.ScrollProducts(ctx, filter, func(page []*Product) error {
+		page, err := s.withAvailability(ctx, page)
+		if err != nil {
+			return err
+		}
+		for _, p := range page {
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
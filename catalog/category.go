@@ -0,0 +1,213 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+
+	"github.com/segmentio/ksuid"
+)
+
+var (
+	ErrInvalidCategory  = errors.New("invalid category")
+	ErrCategoryNotEmpty = errors.New("category has subcategories or products")
+)
+
+// Category is a node in the category tree. Path lists the IDs from the root
+// down to and including the category itself.
+type Category struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	ParentID string   `json:"parentId"`
+	Path     []string `json:"path"`
+}
+
+func (s *CatalogService) GetCategories(ctx context.Context) ([]*Category, error) {
+	return s.repository.ListCategories(ctx)
+}
+
+func (s *CatalogService) CreateCategory(ctx context.Context, name string, parentID string) (*Category, error) {
+	if name == "" {
+		return nil, ErrInvalidCategory
+	}
+
+	c := &Category{
+		ID:       ksuid.New().String(),
+		Name:     name,
+		ParentID: parentID,
+	}
+	if parentID != "" {
+		parent, err := s.repository.GetCategoryByID(ctx, parentID)
+		if err == ErrNotFound {
+			return nil, ErrInvalidCategory
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.Path = append(c.Path, parent.Path...)
+	}
+	c.Path = append(c.Path, c.ID)
+
+	if err := s.repository.PutCategory(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// MoveCategory puts the category under a new parent, or at the root if
+// parentID is empty. The paths of its descendants and of every product in
+// the subtree are rewritten to match.
+func (s *CatalogService) MoveCategory(ctx context.Context, id string, parentID string) (*Category, error) {
+	categories, err := s.categoriesByID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c, ok := categories[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	newPath := []string{}
+	if parentID != "" {
+		parent, ok := categories[parentID]
+		if !ok {
+			return nil, ErrInvalidCategory
+		}
+		for _, ancestor := range parent.Path {
+			if ancestor == id {
+				// The new parent is inside the category's own subtree.
+				return nil, ErrInvalidCategory
+			}
+		}
+		newPath = append(newPath, parent.Path...)
+	}
+	newPath = append(newPath, id)
+
+	oldDepth := len(c.Path)
+	c.ParentID = parentID
+	for _, other := range categories {
+		if !contains(other.Path, id) {
+			continue
+		}
+		other.Path = append(append([]string{}, newPath...), other.Path[oldDepth:]...)
+		if err := s.repository.PutCategory(ctx, other); err != nil {
+			return nil, err
+		}
+	}
+
+	products, err := s.repository.ListProductsInCategory(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range products {
+		if err := s.recategorize(ctx, p, categories); err != nil {
+			log.Println("Error updating category path of product", p.ID, err)
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// DeleteCategory removes an empty category.
+func (s *CatalogService) DeleteCategory(ctx context.Context, id string) error {
+	categories, err := s.categoriesByID(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := categories[id]; !ok {
+		return ErrNotFound
+	}
+	for _, c := range categories {
+		if c.ParentID == id {
+			return ErrCategoryNotEmpty
+		}
+	}
+
+	products, err := s.repository.ListProducts(ctx, ProductFilter{CategoryID: id}, 0, 1)
+	if err != nil {
+		return err
+	}
+	if len(products) != 0 {
+		return ErrCategoryNotEmpty
+	}
+
+	return s.repository.DeleteCategory(ctx, id)
+}
+
+// categoryPath returns the sorted union of the paths of the given
+// categories, which is what a product is filed under.
+func (s *CatalogService) categoryPath(ctx context.Context, categoryIDs []string) ([]string, error) {
+	if len(categoryIDs) == 0 {
+		return nil, nil
+	}
+
+	categories, err := s.categoriesByID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pathOf(categoryIDs, categories)
+}
+
+// recategorize rewrites the product's category path from the current tree,
+// re-reading the product if a concurrent edit got in first.
+func (s *CatalogService) recategorize(ctx context.Context, p *Product, categories map[string]*Category) error {
+	for i := 0; i < maxRetries; i++ {
+		path, err := pathOf(p.CategoryIDs, categories)
+		if err != nil {
+			return err
+		}
+		p.CategoryPath = path
+
+		err = s.repository.UpdateProduct(ctx, p)
+		if err != ErrVersionConflict {
+			return err
+		}
+		if p, err = s.repository.GetProductByID(ctx, p.ID); err != nil {
+			return err
+		}
+	}
+	return ErrVersionConflict
+}
+
+func (s *CatalogService) categoriesByID(ctx context.Context) (map[string]*Category, error) {
+	list, err := s.repository.ListCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	categories := map[string]*Category{}
+	for _, c := range list {
+		categories[c.ID] = c
+	}
+	return categories, nil
+}
+
+func pathOf(categoryIDs []string, categories map[string]*Category) ([]string, error) {
+	seen := map[string]bool{}
+	path := []string{}
+	for _, id := range categoryIDs {
+		c, ok := categories[id]
+		if !ok {
+			return nil, ErrInvalidCategory
+		}
+		for _, ancestor := range c.Path {
+			if !seen[ancestor] {
+				seen[ancestor] = true
+				path = append(path, ancestor)
+			}
+		}
+	}
+	sort.Strings(path)
+	return path, nil
+}
+
+func contains(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
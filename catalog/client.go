@@ -2,10 +2,14 @@ package catalog
 
 import (
 	"context"
+	"io"
+	"time"
 
 	"github.com/jaykapade/cart-microservice/catalog/pb"
+	"github.com/jaykapade/cart-microservice/money"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
 type Client struct {
@@ -29,23 +33,20 @@ func (c *Client) Close() {
 	c.conn.Close()
 }
 
-func (c *Client) PostProduct(ctx context.Context, name, description string, price float64) (*Product, error) {
+func (c *Client) PostProduct(ctx context.Context, name, description string, price money.Money, categoryIDs []string, variants []Variant) (*Product, error) {
 	p, err := c.service.PostProduct(ctx, &pb.PostProductRequest{
 		Name:        name,
 		Description: description,
-		Price:       price,
+		Price:       money.ToProto(price),
+		CategoryIds: categoryIDs,
+		Variants:    variantsToProto(variants),
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &Product{
-		ID:          p.Product.Id,
-		Name:        p.Product.Name,
-		Description: p.Product.Description,
-		Price:       p.Product.Price,
-	}, nil
+	return productFromProto(p.Product), nil
 }
 
 func (c *Client) GetProduct(ctx context.Context, id string) (*Product, error) {
@@ -53,22 +54,12 @@ func (c *Client) GetProduct(ctx context.Context, id string) (*Product, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Product{
-		ID:          r.Product.Id,
-		Name:        r.Product.Name,
-		Description: r.Product.Description,
-		Price:       r.Product.Price,
-	}, nil
+	return productFromProto(r.Product), nil
 }
 
-func (c *Client) GetProducts(ctx context.Context, skip uint64, take uint64, ids []string, query string) ([]*Product, error) {
+func (c *Client) GetProducts(ctx context.Context, skip uint64, take uint64, ids []string, query string, filter ProductFilter) ([]*Product, error) {
 
-	r, err := c.service.GetProducts(ctx, &pb.GetProductsRequest{
-		Skip:  skip,
-		Take:  take,
-		Ids:   ids,
-		Query: query,
-	})
+	r, err := c.service.GetProducts(ctx, productsRequest(skip, take, ids, query, filter))
 
 	if err != nil {
 		return nil, err
@@ -76,13 +67,325 @@ func (c *Client) GetProducts(ctx context.Context, skip uint64, take uint64, ids
 
 	products := []*Product{}
 	for _, p := range r.Products {
-		products = append(products, &Product{
-			ID:          p.Id,
+		products = append(products, productFromProto(p))
+	}
+
+	return products, nil
+}
+
+// UpdateProduct changes the non-nil fields of update. A non-zero version
+// makes the call fail with codes.Aborted if the product has changed since.
+func (c *Client) UpdateProduct(ctx context.Context, id string, update ProductUpdate, version int64) (*Product, error) {
+	req := &pb.UpdateProductRequest{
+		Id:         id,
+		UpdateMask: &fieldmaskpb.FieldMask{},
+		Version:    version,
+	}
+	if update.Name != nil {
+		req.Name = *update.Name
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, "name")
+	}
+	if update.Description != nil {
+		req.Description = *update.Description
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, "description")
+	}
+	if update.Price != nil {
+		req.Price = money.ToProto(*update.Price)
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, "price")
+	}
+	if update.CategoryIDs != nil {
+		req.CategoryIds = *update.CategoryIDs
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, "categoryIds")
+	}
+	if update.Variants != nil {
+		req.Variants = variantsToProto(*update.Variants)
+		req.UpdateMask.Paths = append(req.UpdateMask.Paths, "variants")
+	}
+
+	r, err := c.service.UpdateProduct(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return productFromProto(r.Product), nil
+}
+
+func (c *Client) DeleteProduct(ctx context.Context, id string, version int64) error {
+	_, err := c.service.DeleteProduct(ctx, &pb.DeleteProductRequest{
+		Id:      id,
+		Version: version,
+	})
+	return err
+}
+
+// SearchProducts runs a text search and returns the page of matches with
+// the total match count and facets.
+func (c *Client) SearchProducts(ctx context.Context, query string, filter ProductFilter, skip uint64, take uint64) (*SearchResult, error) {
+	r, err := c.service.GetProducts(ctx, productsRequest(skip, take, nil, query, filter))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SearchResult{
+		Products: []*Product{},
+		Total:    r.Total,
+		Facets: Facets{
+			Price: []PriceBucket{},
+			Terms: []TermFacet{},
+		},
+	}
+	for _, p := range r.Products {
+		result.Products = append(result.Products, productFromProto(p))
+	}
+	for _, b := range r.Facets.GetPrice() {
+		result.Facets.Price = append(result.Facets.Price, PriceBucket{
+			From:  money.FromProto(b.From),
+			To:    money.FromProto(b.To),
+			Count: b.Count,
+		})
+	}
+	for _, t := range r.Facets.GetTerms() {
+		facet := TermFacet{Field: t.Field, Buckets: []TermBucket{}}
+		for _, b := range t.Buckets {
+			facet.Buckets = append(facet.Buckets, TermBucket{Value: b.Value, Count: b.Count})
+		}
+		result.Facets.Terms = append(result.Facets.Terms, facet)
+	}
+
+	return result, nil
+}
+
+func (c *Client) SuggestProducts(ctx context.Context, prefix string, size uint32) ([]*Suggestion, error) {
+	r, err := c.service.SuggestProducts(ctx, &pb.SuggestProductsRequest{
+		Prefix: prefix,
+		Size:   size,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := []*Suggestion{}
+	for _, s := range r.Suggestions {
+		suggestions = append(suggestions, &Suggestion{
+			ProductID: s.ProductId,
+			Name:      s.Name,
+			Score:     s.Score,
+		})
+	}
+	return suggestions, nil
+}
+
+// ImportProducts streams the products returned by next to the catalog
+// until next returns io.EOF, and returns the totals of the import.
+func (c *Client) ImportProducts(ctx context.Context, next func() (*Product, error)) (*ImportSummary, error) {
+	stream, err := c.service.ImportProducts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		p, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			stream.CloseSend()
+			return nil, err
+		}
+
+		err = stream.Send(&pb.ImportProductsRequest{
+			Id:          p.ID,
 			Name:        p.Name,
 			Description: p.Description,
-			Price:       p.Price,
+			Price:       money.ToProto(p.Price),
+			CategoryIds: p.CategoryIDs,
+			Variants:    variantsToProto(p.Variants),
 		})
+		if err == io.EOF {
+			// The server ended the stream; CloseAndRecv returns its error.
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return products, nil
+	r, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &ImportSummary{
+		Created: int(r.Created),
+		Updated: int(r.Updated),
+		Failed:  int(r.Failed),
+	}
+	for _, e := range r.Errors {
+		summary.Errors = append(summary.Errors, ImportError{
+			Row:     int(e.Row),
+			ID:      e.Id,
+			Message: e.Message,
+		})
+	}
+	return summary, nil
+}
+
+// ExportProducts calls fn with every product in the category, or in the
+// whole catalog if categoryID is empty.
+func (c *Client) ExportProducts(ctx context.Context, categoryID string, fn func(*Product) error) error {
+	stream, err := c.service.ExportProducts(ctx, &pb.ExportProductsRequest{CategoryId: categoryID})
+	if err != nil {
+		return err
+	}
+
+	for {
+		p, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(productFromProto(p)); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) AdjustStock(ctx context.Context, productID string, delta int64) (*StockLevel, error) {
+	r, err := c.service.AdjustStock(ctx, &pb.AdjustStockRequest{
+		ProductId: productID,
+		Delta:     delta,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &StockLevel{
+		ProductID: r.Stock.ProductId,
+		OnHand:    r.Stock.OnHand,
+		Reserved:  r.Stock.Reserved,
+		Available: r.Stock.Available,
+	}, nil
+}
+
+// Reserve holds stock for all items, or fails with codes.FailedPrecondition
+// if any of them is short. A zero ttl uses the catalog's default.
+func (c *Client) Reserve(ctx context.Context, reservationID string, items []ReservationItem, ttl time.Duration) (time.Time, error) {
+	req := &pb.ReserveRequest{
+		ReservationId: reservationID,
+		TtlSeconds:    uint32(ttl / time.Second),
+	}
+	for _, item := range items {
+		req.Items = append(req.Items, &pb.ReservationItem{
+			ProductId: item.ProductID,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	r, err := c.service.Reserve(ctx, req)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	expiresAt := time.Time{}
+	if err := expiresAt.UnmarshalBinary(r.ExpiresAt); err != nil {
+		return time.Time{}, err
+	}
+	return expiresAt, nil
+}
+
+func (c *Client) Commit(ctx context.Context, reservationID string, productIDs []string) error {
+	_, err := c.service.Commit(ctx, &pb.CommitRequest{
+		ReservationId: reservationID,
+		ProductIds:    productIDs,
+	})
+	return err
+}
+
+func (c *Client) Release(ctx context.Context, reservationID string, productIDs []string) error {
+	_, err := c.service.Release(ctx, &pb.ReleaseRequest{
+		ReservationId: reservationID,
+		ProductIds:    productIDs,
+	})
+	return err
+}
+
+func productsRequest(skip uint64, take uint64, ids []string, query string, filter ProductFilter) *pb.GetProductsRequest {
+	req := &pb.GetProductsRequest{
+		Skip:       skip,
+		Take:       take,
+		Ids:        ids,
+		Query:      query,
+		CategoryId: filter.CategoryID,
+		Sort:       string(filter.Sort),
+	}
+	if filter.MinPrice != nil {
+		req.MinPrice = money.ToProto(*filter.MinPrice)
+	}
+	if filter.MaxPrice != nil {
+		req.MaxPrice = money.ToProto(*filter.MaxPrice)
+	}
+	return req
+}
+
+func productFromProto(p *pb.Product) *Product {
+	return &Product{
+		ID:                p.Id,
+		Name:              p.Name,
+		Description:       p.Description,
+		Price:             money.FromProto(p.Price),
+		Version:           p.Version,
+		AvailableQuantity: p.AvailableQuantity,
+		CategoryIDs:       p.CategoryIds,
+		Variants:          variantsFromProto(p.Variants),
+	}
+}
+
+func (c *Client) GetCategories(ctx context.Context) ([]*Category, error) {
+	r, err := c.service.GetCategories(ctx, &pb.GetCategoriesRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	categories := []*Category{}
+	for _, c := range r.Categories {
+		categories = append(categories, categoryFromProto(c))
+	}
+	return categories, nil
+}
+
+func (c *Client) CreateCategory(ctx context.Context, name string, parentID string) (*Category, error) {
+	r, err := c.service.CreateCategory(ctx, &pb.CreateCategoryRequest{
+		Name:     name,
+		ParentId: parentID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return categoryFromProto(r.Category), nil
+}
+
+func (c *Client) MoveCategory(ctx context.Context, id string, parentID string) (*Category, error) {
+	r, err := c.service.MoveCategory(ctx, &pb.MoveCategoryRequest{
+		Id:       id,
+		ParentId: parentID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return categoryFromProto(r.Category), nil
+}
+
+func (c *Client) DeleteCategory(ctx context.Context, id string) error {
+	_, err := c.service.DeleteCategory(ctx, &pb.DeleteCategoryRequest{Id: id})
+	return err
+}
+
+func categoryFromProto(c *pb.Category) *Category {
+	return &Category{
+		ID:       c.Id,
+		Name:     c.Name,
+		ParentID: c.ParentId,
+		Path:     c.Path,
+	}
 }
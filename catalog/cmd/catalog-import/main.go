@@ -0,0 +1,278 @@
+// Command catalog-import loads products into the catalog service from CSV or
+// JSONL files and reports how many were created, updated or failed.
+//
+// CSV files start with a header naming the columns id, name, description,
+// price, currency and categoryIds, in any order; categoryIds are separated
+// by semicolons. JSONL files hold one product per line in the form
+//
+//	{"id": "...", "name": "...", "description": "...", "price": "12.50",
+//	 "currency": "USD", "categoryIds": ["..."],
+//	 "variants": [{"sku": "...", "attributes": {"size": "M"}, "price": "13.00", "active": true}]}
+//
+// Rows without an id create new products; rows with one replace that product.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jaykapade/cart-microservice/catalog"
+	"github.com/jaykapade/cart-microservice/money"
+)
+
+type Row struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Price       string       `json:"price"`
+	Currency    string       `json:"currency"`
+	CategoryIDs []string     `json:"categoryIds"`
+	Variants    []VariantRow `json:"variants"`
+}
+
+type VariantRow struct {
+	SKU        string            `json:"sku"`
+	Attributes map[string]string `json:"attributes"`
+	Price      *string           `json:"price"`
+	Active     *bool             `json:"active"`
+}
+
+// reader returns the rows of a file with their line numbers, and io.EOF at
+// the end. A row that cannot be read is returned with its error, as long as
+// the rows after it can still be read.
+type reader func() (*Row, int, error)
+
+// rowError is a row that could not be read or converted.
+type rowError struct {
+	line int
+	err  error
+}
+
+func main() {
+	url := flag.String("url", "localhost:8080", "address of the catalog service")
+	format := flag.String("format", "", "file format, csv or jsonl (default: from the file extension)")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: catalog-import [flags] file...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	client, err := catalog.NewClient(*url)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	failed := false
+	for _, path := range flag.Args() {
+		summary, err := importFile(context.Background(), client, path, *format)
+		if err != nil {
+			log.Fatal(path, ": ", err)
+		}
+		if summary.Failed > 0 {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func importFile(ctx context.Context, client *catalog.Client, path string, format string) (*catalog.ImportSummary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+	var next reader
+	switch format {
+	case "csv":
+		next, err = csvReader(f)
+	case "jsonl", "ndjson":
+		next = jsonlReader(f)
+	default:
+		err = fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// lines maps the rows sent, counted from 1, to their lines in the file.
+	lines := []int{0}
+	rejected := []rowError{}
+	summary, err := client.ImportProducts(ctx, func() (*catalog.Product, error) {
+		for {
+			row, line, err := next()
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			var p *catalog.Product
+			if err == nil {
+				p, err = row.product()
+			}
+			if err != nil {
+				var fatal *fatalError
+				if errors.As(err, &fatal) {
+					return nil, err
+				}
+				rejected = append(rejected, rowError{line: line, err: err})
+				continue
+			}
+			lines = append(lines, line)
+			return p, nil
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	summary.Failed += len(rejected)
+	fmt.Printf("%s: created %d, updated %d, failed %d\n", path, summary.Created, summary.Updated, summary.Failed)
+	for _, r := range rejected {
+		fmt.Printf("  line %d: %v\n", r.line, r.err)
+	}
+	for _, e := range summary.Errors {
+		fmt.Printf("  line %d: %s: %s\n", lines[e.Row], e.ID, e.Message)
+	}
+	return summary, nil
+}
+
+// fatalError stops the import, as the rest of the file cannot be read.
+type fatalError struct {
+	err error
+}
+
+func (e *fatalError) Error() string {
+	return e.err.Error()
+}
+
+func csvReader(r io.Reader) (reader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, errors.New("missing name column")
+	}
+	if _, ok := columns["price"]; !ok {
+		return nil, errors.New("missing price column")
+	}
+
+	return func() (*Row, int, error) {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, parseErr.StartLine, err
+		}
+		if err != nil {
+			return nil, 0, &fatalError{err}
+		}
+
+		line, _ := cr.FieldPos(0)
+		field := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		row := &Row{
+			ID:          field("id"),
+			Name:        field("name"),
+			Description: field("description"),
+			Price:       field("price"),
+			Currency:    field("currency"),
+		}
+		for _, id := range strings.Split(field("categoryIds"), ";") {
+			if id = strings.TrimSpace(id); id != "" {
+				row.CategoryIDs = append(row.CategoryIDs, id)
+			}
+		}
+		return row, line, nil
+	}, nil
+}
+
+func jsonlReader(r io.Reader) reader {
+	br := bufio.NewReader(r)
+	line := 0
+	return func() (*Row, int, error) {
+		for {
+			text, err := br.ReadString('\n')
+			if err == io.EOF && text == "" {
+				return nil, 0, io.EOF
+			}
+			if err != nil && err != io.EOF {
+				return nil, 0, &fatalError{err}
+			}
+			line++
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+
+			row := &Row{}
+			if err := json.Unmarshal([]byte(text), row); err != nil {
+				return nil, line, err
+			}
+			return row, line, nil
+		}
+	}
+}
+
+func (r *Row) product() (*catalog.Product, error) {
+	price, err := money.Parse(r.Price, r.Currency)
+	if err != nil {
+		return nil, fmt.Errorf("price %q: %w", r.Price, err)
+	}
+
+	p := &catalog.Product{
+		ID:          r.ID,
+		Name:        r.Name,
+		Description: r.Description,
+		Price:       price,
+		CategoryIDs: r.CategoryIDs,
+		Variants:    []catalog.Variant{},
+	}
+	for _, v := range r.Variants {
+		variant := catalog.Variant{
+			SKU:        v.SKU,
+			Attributes: v.Attributes,
+			Active:     v.Active == nil || *v.Active,
+		}
+		if v.Price != nil {
+			vp, err := money.Parse(*v.Price, r.Currency)
+			if err != nil {
+				return nil, fmt.Errorf("price %q of variant %s: %w", *v.Price, v.SKU, err)
+			}
+			variant.Price = &vp
+		}
+		p.Variants = append(p.Variants, variant)
+	}
+	return p, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"net/url"
 	"time"
 
 	"github.com/jaykapade/cart-microservice/catalog"
@@ -20,14 +21,22 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// postgres:// URLs select the Postgres backend; anything else is taken
+	// to be an Elasticsearch node.
+	newRepository, backend := catalog.NewElasticRepository, "elasticsearch"
+	if u, err := url.Parse(cfg.DatabaseURL); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		newRepository, backend = catalog.NewPostgresRepository, "postgres"
+	}
+
 	var r catalog.Repository
 	retry.ForeverSleep(2*time.Second, func(_ int) error {
-		r, err = catalog.NewElasticRepository(cfg.DatabaseURL)
+		r, err = newRepository(cfg.DatabaseURL)
 		if err != nil {
 			log.Println(err)
+			return err
 		}
-		log.Println("Connection to elasticsearch successful...", cfg.DatabaseURL)
-		return err
+		log.Println("Connection to", backend, "successful...", cfg.DatabaseURL)
+		return nil
 	})
 	defer r.Close()
 	log.Println("Listening on port 8080...")
@@ -0,0 +1,48 @@
+package catalog
+
+import "github.com/jaykapade/cart-microservice/money"
+
+// priceBucketWidth is the width of a price histogram bucket in minor units,
+// i.e. 10.00 in currencies with two decimals.
+const priceBucketWidth = 1000
+
+// termFacets lists the keyword fields that search results are counted by.
+// Currencies are not among them; the price facet already counts by currency.
+var termFacets = []string{"categories"}
+
+// attributeFacetPrefix starts the field of each variant attribute facet, which
+// counts the products with an active variant by that attribute's values, e.g.
+// "variants.attributes.size". They follow termFacets, ordered by name.
+const attributeFacetPrefix = "variants.attributes."
+
+// SearchResult is one page of a product search with the total number of
+// matches and facet counts over all of them.
+type SearchResult struct {
+	Products []*Product
+	Total    int64
+	Facets   Facets
+}
+
+type Facets struct {
+	// Price buckets are per currency, as amounts in different currencies
+	// cannot be compared.
+	Price []PriceBucket
+	Terms []TermFacet
+}
+
+// PriceBucket counts the products priced in [From, To).
+type PriceBucket struct {
+	From  money.Money
+	To    money.Money
+	Count int64
+}
+
+type TermFacet struct {
+	Field   string
+	Buckets []TermBucket
+}
+
+type TermBucket struct {
+	Value string
+	Count int64
+}
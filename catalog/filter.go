@@ -0,0 +1,49 @@
+package catalog
+
+import (
+	"errors"
+
+	"github.com/jaykapade/cart-microservice/money"
+)
+
+var (
+	ErrInvalidFilter = errors.New("invalid product filter")
+)
+
+type Sort string
+
+const (
+	// SortRelevance orders search results by score and leaves plain
+	// listings in index order.
+	SortRelevance Sort = "relevance"
+	SortPriceAsc  Sort = "price_asc"
+	SortPriceDesc Sort = "price_desc"
+	SortNewest    Sort = "newest"
+)
+
+// ProductFilter narrows a product listing. Zero values leave a field
+// unfiltered. Price bounds only match products in the bound's currency.
+type ProductFilter struct {
+	// CategoryID matches products in the category or any of its descendants.
+	CategoryID string
+	MinPrice   *money.Money
+	MaxPrice   *money.Money
+	Sort       Sort
+}
+
+func (f ProductFilter) Validate() error {
+	switch f.Sort {
+	case "", SortRelevance, SortPriceAsc, SortPriceDesc, SortNewest:
+	default:
+		return ErrInvalidFilter
+	}
+	if f.MinPrice != nil && !money.ValidCurrency(f.MinPrice.Currency) ||
+		f.MaxPrice != nil && !money.ValidCurrency(f.MaxPrice.Currency) {
+		return ErrInvalidFilter
+	}
+	if f.MinPrice != nil && f.MaxPrice != nil &&
+		(f.MinPrice.Currency != f.MaxPrice.Currency || f.MaxPrice.Amount < f.MinPrice.Amount) {
+		return ErrInvalidFilter
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	ErrInsufficientStock   = errors.New("insufficient stock")
+	ErrInvalidQuantity     = errors.New("invalid quantity")
+	ErrReservationNotFound = errors.New("reservation not found or expired")
+)
+
+const (
+	DefaultReservationTTL = 15 * time.Minute
+
+	// maxRetries bounds the read-modify-write attempts on one document
+	// before a busy product gives up with ErrVersionConflict.
+	maxRetries = 5
+)
+
+// Stock is the inventory of one product. Reserved units are held for orders
+// being placed and are not available to anyone else until the reservation
+// is committed, released or expires.
+type Stock struct {
+	ProductID    string
+	OnHand       int64
+	Reservations []Reservation
+	Version      int64
+}
+
+type Reservation struct {
+	ID        string    `json:"id"`
+	Quantity  uint32    `json:"quantity"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Committed reservations are already taken off OnHand. They are kept
+	// until they expire so that committing again is a no-op.
+	Committed bool `json:"committed"`
+}
+
+type ReservationItem struct {
+	ProductID string
+	Quantity  uint32
+}
+
+type StockLevel struct {
+	ProductID string
+	OnHand    int64
+	Reserved  int64
+	Available int64
+}
+
+func (s *Stock) Reserved(now time.Time) int64 {
+	var reserved int64
+	for _, r := range s.Reservations {
+		if !r.Committed && r.ExpiresAt.After(now) {
+			reserved += int64(r.Quantity)
+		}
+	}
+	return reserved
+}
+
+func (s *Stock) Available(now time.Time) int64 {
+	return s.OnHand - s.Reserved(now)
+}
+
+func (s *Stock) Level(now time.Time) *StockLevel {
+	reserved := s.Reserved(now)
+	return &StockLevel{
+		ProductID: s.ProductID,
+		OnHand:    s.OnHand,
+		Reserved:  reserved,
+		Available: s.OnHand - reserved,
+	}
+}
+
+// prune drops expired reservations, which releases the stock they held.
+func (s *Stock) prune(now time.Time) {
+	active := []Reservation{}
+	for _, r := range s.Reservations {
+		if r.ExpiresAt.After(now) {
+			active = append(active, r)
+		}
+	}
+	s.Reservations = active
+}
+
+func (s *Stock) reservation(id string) *Reservation {
+	for i := range s.Reservations {
+		if s.Reservations[i].ID == id {
+			return &s.Reservations[i]
+		}
+	}
+	return nil
+}
+
+func (s *CatalogService) AdjustStock(ctx context.Context, productID string, delta int64) (*StockLevel, error) {
+	if _, err := s.repository.GetProductByID(ctx, productID); err != nil {
+		return nil, err
+	}
+
+	stock, err := s.updateStock(ctx, productID, func(stock *Stock, now time.Time) error {
+		if stock.Available(now)+delta < 0 {
+			return ErrInsufficientStock
+		}
+		stock.OnHand += delta
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stock.Level(time.Now().UTC()), nil
+}
+
+// Reserve holds stock for every item under reservationID until ttl passes.
+// Either all items are reserved or none are. Reserving an ID that is already
+// held is a no-op, so callers can retry with the same ID.
+func (s *CatalogService) Reserve(ctx context.Context, reservationID string, items []ReservationItem, ttl time.Duration) (time.Time, error) {
+	if ttl <= 0 {
+		ttl = DefaultReservationTTL
+	}
+	expiresAt := time.Now().UTC().Add(ttl)
+
+	quantities := map[string]uint32{}
+	productIDs := []string{}
+	for _, item := range items {
+		if item.Quantity == 0 {
+			return time.Time{}, ErrInvalidQuantity
+		}
+		if _, ok := quantities[item.ProductID]; !ok {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		quantities[item.ProductID] += item.Quantity
+	}
+	if reservationID == "" || len(productIDs) == 0 {
+		return time.Time{}, ErrInvalidQuantity
+	}
+
+	for i, productID := range productIDs {
+		_, err := s.updateStock(ctx, productID, func(stock *Stock, now time.Time) error {
+			if stock.reservation(reservationID) != nil {
+				return nil
+			}
+			if stock.Available(now) < int64(quantities[productID]) {
+				return fmt.Errorf("%w for product %s", ErrInsufficientStock, productID)
+			}
+			stock.Reservations = append(stock.Reservations, Reservation{
+				ID:        reservationID,
+				Quantity:  quantities[productID],
+				ExpiresAt: expiresAt,
+			})
+			return nil
+		})
+		if err != nil {
+			if releaseErr := s.Release(ctx, reservationID, productIDs[:i]); releaseErr != nil {
+				log.Println("Error releasing partial reservation", reservationID, releaseErr)
+			}
+			return time.Time{}, err
+		}
+	}
+
+	return expiresAt, nil
+}
+
+// Commit takes the reserved units off the shelf for good. Either all items
+// are committed or none are. Committing a reservation twice is a no-op;
+// committing one that has expired fails.
+func (s *CatalogService) Commit(ctx context.Context, reservationID string, productIDs []string) error {
+	committed := map[string]uint32{}
+	for _, productID := range productIDs {
+		_, err := s.updateStock(ctx, productID, func(stock *Stock, now time.Time) error {
+			delete(committed, productID)
+			r := stock.reservation(reservationID)
+			if r == nil {
+				return ErrReservationNotFound
+			}
+			if !r.Committed {
+				stock.OnHand -= int64(r.Quantity)
+				r.Committed = true
+				committed[productID] = r.Quantity
+			}
+			return nil
+		})
+		if err != nil {
+			s.uncommit(ctx, reservationID, committed)
+			return err
+		}
+	}
+	return nil
+}
+
+// uncommit puts the units a failed Commit took back on the shelf and holds
+// them under the reservation again, so it can still be released.
+func (s *CatalogService) uncommit(ctx context.Context, reservationID string, quantities map[string]uint32) {
+	for productID, quantity := range quantities {
+		_, err := s.updateStock(ctx, productID, func(stock *Stock, now time.Time) error {
+			stock.OnHand += int64(quantity)
+			if r := stock.reservation(reservationID); r != nil {
+				r.Committed = false
+			}
+			return nil
+		})
+		if err != nil {
+			log.Println("Error undoing partial commit", reservationID, productID, err)
+		}
+	}
+}
+
+// Release returns held units to available stock. Releasing an unknown,
+// expired or committed reservation is a no-op.
+func (s *CatalogService) Release(ctx context.Context, reservationID string, productIDs []string) error {
+	for _, productID := range productIDs {
+		_, err := s.updateStock(ctx, productID, func(stock *Stock, now time.Time) error {
+			for i, r := range stock.Reservations {
+				if r.ID == reservationID && !r.Committed {
+					stock.Reservations = append(stock.Reservations[:i], stock.Reservations[i+1:]...)
+					break
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateStock applies fn to the product's current stock and writes it back,
+// starting over if another writer got there first.
+func (s *CatalogService) updateStock(ctx context.Context, productID string, fn func(stock *Stock, now time.Time) error) (*Stock, error) {
+	for i := 0; i < maxRetries; i++ {
+		stock, err := s.repository.GetStock(ctx, productID)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now().UTC()
+		stock.prune(now)
+		if err := fn(stock, now); err != nil {
+			return nil, err
+		}
+
+		err = s.repository.PutStock(ctx, stock)
+		if err == ErrVersionConflict {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return stock, nil
+	}
+	return nil, ErrVersionConflict
+}
+
+// withAvailability fills in the available quantity of each product.
+func (s *CatalogService) withAvailability(ctx context.Context, products []*Product) ([]*Product, error) {
+	if len(products) == 0 {
+		return products, nil
+	}
+
+	ids := []string{}
+	for _, p := range products {
+		ids = append(ids, p.ID)
+	}
+	stocks, err := s.repository.ListStock(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	available := map[string]int64{}
+	for _, stock := range stocks {
+		available[stock.ProductID] = stock.Available(now)
+	}
+	for _, p := range products {
+		p.AvailableQuantity = available[p.ID]
+	}
+	return products, nil
+}
@@ -0,0 +1,782 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/jaykapade/cart-microservice/money"
+	"github.com/lib/pq"
+)
+
+// schema creates the tables the Postgres repository needs if they are
+// missing, much like putMappings does for Elasticsearch.
+//
+//go:embed up.sql
+var schema string
+
+// termFacetSize matches the default size of an Elasticsearch terms
+// aggregation, so both repositories return the same facets.
+const termFacetSize = 10
+
+// termFacetColumns maps each of termFacets to the expression it counts.
+var termFacetColumns = map[string]string{
+	"categories": "unnest(category_ids)",
+}
+
+const productColumns = `id, name, description, price, currency, category_ids, category_path, variants, created_at, version`
+
+// upsertProduct inserts a product or replaces the stored one and bumps its
+// version. The creation time is left alone on replace; callers append any
+// further assignments and a RETURNING clause.
+const upsertProduct = `INSERT INTO products (id, name, description, price, currency, category_ids, category_path, variants, suggest, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	ON CONFLICT (id) DO UPDATE SET
+	name = EXCLUDED.name,
+	description = EXCLUDED.description,
+	price = EXCLUDED.price,
+	currency = EXCLUDED.currency,
+	category_ids = EXCLUDED.category_ids,
+	category_path = EXCLUDED.category_path,
+	variants = EXCLUDED.variants,
+	suggest = EXCLUDED.suggest,
+	version = products.version + 1`
+
+// PostgresRepository is a Repository backed by Postgres. Search uses a
+// tsvector over names and descriptions, and trigram word similarity on names
+// so that misspelled queries still match.
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(url string) (Repository, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &PostgresRepository{db: db}, nil
+}
+
+func (r *PostgresRepository) Close() {
+	r.db.Close()
+}
+
+func (r *PostgresRepository) GetProductByID(ctx context.Context, id string) (*Product, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+productColumns+` FROM products WHERE id = $1`, id)
+	p, err := scanProduct(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return p, err
+}
+
+func (r *PostgresRepository) ListProducts(ctx context.Context, filter ProductFilter, skip uint64, take uint64) ([]*Product, error) {
+	q := newProductQuery("", filter)
+	return queryProducts(ctx, r.db,
+		`SELECT `+productColumns+` FROM products `+q.where()+` `+q.orderBy(filter.Sort)+
+			` OFFSET `+q.arg(skip)+` LIMIT `+q.arg(take),
+		q.args...,
+	)
+}
+
+// ListProductsInCategory returns every product filed under the category or
+// any of its descendants.
+func (r *PostgresRepository) ListProductsInCategory(ctx context.Context, categoryID string) ([]*Product, error) {
+	products := []*Product{}
+	err := r.ScrollProducts(ctx, ProductFilter{CategoryID: categoryID}, func(page []*Product) error {
+		products = append(products, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// ScrollProducts pages through the matching products by ID, so products
+// written during the scroll may or may not be seen.
+func (r *PostgresRepository) ScrollProducts(ctx context.Context, filter ProductFilter, fn func([]*Product) error) error {
+	last := ""
+	for {
+		q := newProductQuery("", filter)
+		q.conds = append(q.conds, "id > "+q.arg(last))
+		products, err := queryProducts(ctx, r.db,
+			`SELECT `+productColumns+` FROM products `+q.where()+` ORDER BY id LIMIT 500`,
+			q.args...,
+		)
+		if err != nil {
+			return err
+		}
+		if len(products) == 0 {
+			return nil
+		}
+		if err := fn(products); err != nil {
+			return err
+		}
+		last = products[len(products)-1].ID
+	}
+}
+
+// ListProductsWithIDs returns the products in the order of ids, skipping
+// those that do not exist.
+func (r *PostgresRepository) ListProductsWithIDs(ctx context.Context, ids []string) ([]*Product, error) {
+	found, err := queryProducts(ctx, r.db, `SELECT `+productColumns+` FROM products WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	byID := map[string]*Product{}
+	for _, p := range found {
+		byID[p.ID] = p
+	}
+	products := []*Product{}
+	for _, id := range ids {
+		if p, ok := byID[id]; ok {
+			products = append(products, p)
+		}
+	}
+	return products, nil
+}
+
+// SearchProducts returns a page of matches together with facet counts over
+// every match, not just the page. All of it is read from one snapshot.
+func (r *PostgresRepository) SearchProducts(ctx context.Context, query string, filter ProductFilter, skip uint64, take uint64) (*SearchResult, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	q := newProductQuery(query, filter)
+	result := &SearchResult{
+		Facets: Facets{
+			Price: []PriceBucket{},
+			Terms: []TermFacet{},
+		},
+	}
+
+	page := *q
+	page.args = append([]interface{}{}, q.args...)
+	result.Products, err = queryProducts(ctx, tx,
+		`SELECT `+productColumns+` FROM products `+page.where()+` `+page.orderBy(filter.Sort)+
+			` OFFSET `+page.arg(skip)+` LIMIT `+page.arg(take),
+		page.args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRowContext(ctx, `SELECT count(*) FROM products `+q.where(), q.args...).Scan(&result.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Facets.Price, err = priceFacet(ctx, tx, q); err != nil {
+		return nil, err
+	}
+	for _, field := range termFacets {
+		facet, err := termFacet(ctx, tx, q, field)
+		if err != nil {
+			return nil, err
+		}
+		result.Facets.Terms = append(result.Facets.Terms, facet)
+	}
+	attributes, err := attributeFacets(ctx, tx, q)
+	if err != nil {
+		return nil, err
+	}
+	result.Facets.Terms = append(result.Facets.Terms, attributes...)
+
+	return result, nil
+}
+
+// SuggestProducts completes prefix against the word-aligned tails of product
+// names, ranking names by how closely a word in them matches the prefix.
+func (r *PostgresRepository) SuggestProducts(ctx context.Context, prefix string, size int) ([]*Suggestion, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`SELECT id, name, word_similarity($1, name) AS score
+		FROM products
+		WHERE EXISTS (SELECT 1 FROM unnest(suggest) AS s WHERE lower(s) LIKE $2)
+		ORDER BY score DESC, name
+		LIMIT $3`,
+		prefix,
+		likePrefix(strings.ToLower(prefix)),
+		size,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []*Suggestion{}
+	for rows.Next() {
+		s := &Suggestion{}
+		if err := rows.Scan(&s.ProductID, &s.Name, &s.Score); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return suggestions, nil
+}
+
+func (r *PostgresRepository) PutProduct(ctx context.Context, p *Product) error {
+	args, err := productArgs(p)
+	if err != nil {
+		return err
+	}
+	return r.db.QueryRowContext(ctx, upsertProduct+`, created_at = EXCLUDED.created_at RETURNING version`, args...).Scan(&p.Version)
+}
+
+// ImportProducts writes the products in one transaction. Each product
+// replaces the stored one but keeps its creation time, or is created if it
+// does not exist. The results are in the order of products; a row that
+// Postgres rejects is rolled back to its savepoint and only fails that row.
+func (r *PostgresRepository) ImportProducts(ctx context.Context, products []*Product) (results []ImportResult, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	// xmax is only zero for rows the statement inserted.
+	stmt, err := tx.PrepareContext(ctx, upsertProduct+` RETURNING version, xmax = 0`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	results = []ImportResult{}
+	for _, p := range products {
+		result := ImportResult{ID: p.ID}
+		args, argErr := productArgs(p)
+		if argErr != nil {
+			result.Err = argErr
+			results = append(results, result)
+			continue
+		}
+
+		if _, err = tx.ExecContext(ctx, `SAVEPOINT import_row`); err != nil {
+			return nil, err
+		}
+		rowErr := stmt.QueryRowContext(ctx, args...).Scan(&p.Version, &result.Created)
+		if rowErr != nil {
+			if _, err = tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT import_row`); err != nil {
+				return nil, err
+			}
+			result.Err = rowErr
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// UpdateProduct replaces the product only if it is still at p.Version, and
+// sets p.Version to the new version on success.
+func (r *PostgresRepository) UpdateProduct(ctx context.Context, p *Product) error {
+	args, err := productArgs(p)
+	if err != nil {
+		return err
+	}
+	args = append(args, p.Version)
+
+	err = r.db.QueryRowContext(
+		ctx,
+		`UPDATE products SET
+		name = $2,
+		description = $3,
+		price = $4,
+		currency = $5,
+		category_ids = $6,
+		category_path = $7,
+		variants = $8,
+		suggest = $9,
+		created_at = $10,
+		version = version + 1
+		WHERE id = $1 AND version = $11
+		RETURNING version`,
+		args...,
+	).Scan(&p.Version)
+	if err == sql.ErrNoRows {
+		return ErrVersionConflict
+	}
+	return err
+}
+
+// DeleteProduct removes the product if it is still at version. A zero
+// version deletes whatever version is current.
+func (r *PostgresRepository) DeleteProduct(ctx context.Context, id string, version int64) error {
+	res, err := r.db.ExecContext(
+		ctx,
+		`DELETE FROM products WHERE id = $1 AND ($2::BIGINT = 0 OR version = $2::BIGINT)`,
+		id,
+		version,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	if _, err := r.GetProductByID(ctx, id); err != nil {
+		return err
+	}
+	return ErrVersionConflict
+}
+
+// GetStock returns the product's stock. A product that has never been
+// stocked has an empty Stock with a zero version.
+func (r *PostgresRepository) GetStock(ctx context.Context, productID string) (*Stock, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT product_id, on_hand, reservations, version FROM stock WHERE product_id = $1`, productID)
+	s, err := scanStock(row)
+	if err == sql.ErrNoRows {
+		return &Stock{ProductID: productID}, nil
+	}
+	return s, err
+}
+
+func (r *PostgresRepository) ListStock(ctx context.Context, productIDs []string) ([]*Stock, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`SELECT product_id, on_hand, reservations, version FROM stock WHERE product_id = ANY($1)`,
+		pq.Array(productIDs),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stocks := []*Stock{}
+	for rows.Next() {
+		s, err := scanStock(rows)
+		if err != nil {
+			return nil, err
+		}
+		stocks = append(stocks, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return stocks, nil
+}
+
+// PutStock writes the stock only if it is still at s.Version; a zero version
+// only succeeds if no stock row exists yet.
+func (r *PostgresRepository) PutStock(ctx context.Context, s *Stock) error {
+	reservations := s.Reservations
+	if reservations == nil {
+		reservations = []Reservation{}
+	}
+	data, err := json.Marshal(reservations)
+	if err != nil {
+		return err
+	}
+
+	var row *sql.Row
+	if s.Version == 0 {
+		row = r.db.QueryRowContext(
+			ctx,
+			`INSERT INTO stock (product_id, on_hand, reservations) VALUES ($1, $2, $3)
+			ON CONFLICT (product_id) DO NOTHING
+			RETURNING version`,
+			s.ProductID,
+			s.OnHand,
+			string(data),
+		)
+	} else {
+		row = r.db.QueryRowContext(
+			ctx,
+			`UPDATE stock SET on_hand = $2, reservations = $3, version = version + 1
+			WHERE product_id = $1 AND version = $4
+			RETURNING version`,
+			s.ProductID,
+			s.OnHand,
+			string(data),
+			s.Version,
+		)
+	}
+
+	err = row.Scan(&s.Version)
+	if err == sql.ErrNoRows {
+		return ErrVersionConflict
+	}
+	return err
+}
+
+func (r *PostgresRepository) GetCategoryByID(ctx context.Context, id string) (*Category, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT id, name, parent_id, path FROM categories WHERE id = $1`, id)
+	c := &Category{}
+	err := row.Scan(&c.ID, &c.Name, &c.ParentID, pq.Array(&c.Path))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ListCategories returns the whole tree, up to maxCategories.
+func (r *PostgresRepository) ListCategories(ctx context.Context) ([]*Category, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, name, parent_id, path FROM categories ORDER BY id LIMIT $1`, maxCategories)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []*Category{}
+	for rows.Next() {
+		c := &Category{}
+		if err := rows.Scan(&c.ID, &c.Name, &c.ParentID, pq.Array(&c.Path)); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+func (r *PostgresRepository) PutCategory(ctx context.Context, c *Category) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		`INSERT INTO categories (id, name, parent_id, path) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, parent_id = EXCLUDED.parent_id, path = EXCLUDED.path`,
+		c.ID,
+		c.Name,
+		c.ParentID,
+		textArray(c.Path),
+	)
+	return err
+}
+
+func (r *PostgresRepository) DeleteCategory(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM categories WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// productQuery holds the conditions and arguments of a product listing or
+// search. rank scores text matches and is empty for plain listings.
+type productQuery struct {
+	conds []string
+	args  []interface{}
+	rank  string
+}
+
+// newProductQuery matches text like the Elasticsearch multi_match query: a
+// product matches if any word of text is in its name or description. Names
+// that are a close trigram match for text also match, to forgive typos.
+func newProductQuery(text string, filter ProductFilter) *productQuery {
+	q := &productQuery{}
+
+	if text != "" {
+		t := q.arg(text)
+		match := t + " <% name"
+		q.rank = "word_similarity(" + t + ", name)"
+
+		words := strings.FieldsFunc(text, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		tsqueries := []string{}
+		for _, w := range words {
+			tsqueries = append(tsqueries, "plainto_tsquery('english', "+q.arg(w)+")")
+		}
+		if len(tsqueries) > 0 {
+			tsquery := "(" + strings.Join(tsqueries, " || ") + ")"
+			match = "(search @@ " + tsquery + " OR " + match + ")"
+			q.rank = "ts_rank(search, " + tsquery + ") + " + q.rank
+		}
+		q.conds = append(q.conds, match)
+	}
+
+	if filter.CategoryID != "" {
+		q.conds = append(q.conds, "category_path @> ARRAY["+q.arg(filter.CategoryID)+"]::TEXT[]")
+	}
+	if filter.MinPrice != nil {
+		q.conds = append(q.conds, "currency = "+q.arg(filter.MinPrice.Currency))
+		q.conds = append(q.conds, "price >= "+q.arg(filter.MinPrice.Amount))
+	}
+	if filter.MaxPrice != nil {
+		q.conds = append(q.conds, "currency = "+q.arg(filter.MaxPrice.Currency))
+		q.conds = append(q.conds, "price <= "+q.arg(filter.MaxPrice.Amount))
+	}
+
+	return q
+}
+
+func (q *productQuery) arg(v interface{}) string {
+	q.args = append(q.args, v)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+func (q *productQuery) where() string {
+	if len(q.conds) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(q.conds, " AND ")
+}
+
+// orderBy orders results by the requested sort, falling back to relevance
+// and then ID so that pages are stable.
+func (q *productQuery) orderBy(sort Sort) string {
+	order := []string{}
+	switch sort {
+	case SortPriceAsc:
+		order = append(order, "price ASC")
+	case SortPriceDesc:
+		order = append(order, "price DESC")
+	case SortNewest:
+		order = append(order, "created_at DESC")
+	}
+	if q.rank != "" {
+		order = append(order, q.rank+" DESC")
+	}
+	order = append(order, "id")
+	return "ORDER BY " + strings.Join(order, ", ")
+}
+
+// priceFacet counts the matches in price buckets per currency, currencies
+// with the most matches first.
+func priceFacet(ctx context.Context, tx *sql.Tx, q *productQuery) ([]PriceBucket, error) {
+	bucket := fmt.Sprintf("price / %d * %d", priceBucketWidth, priceBucketWidth)
+	rows, err := tx.QueryContext(
+		ctx,
+		`SELECT currency, `+bucket+` AS bucket, count(*)
+		FROM products `+q.where()+`
+		GROUP BY currency, bucket
+		ORDER BY sum(count(*)) OVER (PARTITION BY currency) DESC, currency, bucket`,
+		q.args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []PriceBucket{}
+	for rows.Next() {
+		var currency string
+		var from, count int64
+		if err := rows.Scan(&currency, &from, &count); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, PriceBucket{
+			From:  money.New(from, currency),
+			To:    money.New(from+priceBucketWidth, currency),
+			Count: count,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
+
+// termFacet counts the matches by the values of field, most frequent first.
+func termFacet(ctx context.Context, tx *sql.Tx, q *productQuery, field string) (TermFacet, error) {
+	facet := TermFacet{Field: field, Buckets: []TermBucket{}}
+	rows, err := tx.QueryContext(
+		ctx,
+		`SELECT value, count(*)
+		FROM (SELECT `+termFacetColumns[field]+` AS value FROM products `+q.where()+`) AS t
+		GROUP BY value
+		ORDER BY count(*) DESC, value
+		LIMIT `+fmt.Sprint(termFacetSize),
+		q.args...,
+	)
+	if err != nil {
+		return facet, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		b := TermBucket{}
+		if err := rows.Scan(&b.Value, &b.Count); err != nil {
+			return facet, err
+		}
+		facet.Buckets = append(facet.Buckets, b)
+	}
+	return facet, rows.Err()
+}
+
+// attributeFacets counts the matches by the attributes of their active
+// variants, one facet per attribute name. A product is counted once per value
+// however many of its variants have it.
+func attributeFacets(ctx context.Context, tx *sql.Tx, q *productQuery) ([]TermFacet, error) {
+	rows, err := tx.QueryContext(
+		ctx,
+		`SELECT name, value, count
+		FROM (
+			SELECT a.key AS name, a.value, count(DISTINCT p.id) AS count,
+			row_number() OVER (PARTITION BY a.key ORDER BY count(DISTINCT p.id) DESC, a.value COLLATE "C") AS rank
+			FROM (SELECT id, variants FROM products `+q.where()+`) AS p
+			CROSS JOIN LATERAL jsonb_array_elements(p.variants) AS v
+			CROSS JOIN LATERAL jsonb_each_text(
+				CASE jsonb_typeof(v->'attributes') WHEN 'object' THEN v->'attributes' ELSE '{}' END
+			) AS a
+			WHERE (v->>'active')::boolean
+			GROUP BY a.key, a.value
+		) AS t
+		WHERE rank <= `+fmt.Sprint(termFacetSize)+`
+		ORDER BY name COLLATE "C", rank`,
+		q.args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := []TermFacet{}
+	for rows.Next() {
+		var name string
+		b := TermBucket{}
+		if err := rows.Scan(&name, &b.Value, &b.Count); err != nil {
+			return nil, err
+		}
+		if len(facets) == 0 || facets[len(facets)-1].Field != attributeFacetPrefix+name {
+			facets = append(facets, TermFacet{Field: attributeFacetPrefix + name, Buckets: []TermBucket{}})
+		}
+		facet := &facets[len(facets)-1]
+		facet.Buckets = append(facet.Buckets, b)
+	}
+	return facets, rows.Err()
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func queryProducts(ctx context.Context, db queryer, query string, args ...interface{}) ([]*Product, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []*Product{}
+	for rows.Next() {
+		p, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// scanProduct reads the productColumns of a row through a ProductDocument,
+// so products come out exactly as they do from Elasticsearch.
+func scanProduct(row interface{ Scan(...interface{}) error }) (*Product, error) {
+	d := ProductDocument{}
+	var id string
+	var variants []byte
+	var version int64
+	err := row.Scan(
+		&id,
+		&d.Name,
+		&d.Description,
+		&d.Price,
+		&d.Currency,
+		pq.Array(&d.Categories),
+		pq.Array(&d.CategoryPath),
+		&variants,
+		&d.CreatedAt,
+		&version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(variants, &d.Variants); err != nil {
+		return nil, err
+	}
+	d.CreatedAt = d.CreatedAt.UTC()
+	return d.product(id, &version), nil
+}
+
+func scanStock(row interface{ Scan(...interface{}) error }) (*Stock, error) {
+	s := &Stock{}
+	var reservations []byte
+	if err := row.Scan(&s.ProductID, &s.OnHand, &reservations, &s.Version); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(reservations, &s.Reservations); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// productArgs returns the values of upsertProduct's placeholders.
+func productArgs(p *Product) ([]interface{}, error) {
+	variants, err := json.Marshal(variantDocuments(p.Variants))
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{
+		p.ID,
+		p.Name,
+		p.Description,
+		p.Price.Amount,
+		p.Price.Currency,
+		textArray(p.CategoryIDs),
+		textArray(p.CategoryPath),
+		string(variants),
+		textArray(suggestInputs(p.Name)),
+		p.CreatedAt,
+	}, nil
+}
+
+// textArray passes a nil slice as an empty array rather than NULL.
+func textArray(s []string) interface{} {
+	if s == nil {
+		s = []string{}
+	}
+	return pq.Array(s)
+}
+
+// likePrefix escapes the LIKE wildcards in prefix and matches anything that
+// starts with it.
+func likePrefix(prefix string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(prefix) + "%"
+}
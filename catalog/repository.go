@@ -4,22 +4,43 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log"
+	"sort"
+	"time"
 
+	"github.com/jaykapade/cart-microservice/money"
 	"gopkg.in/olivere/elastic.v5"
 )
 
 var (
-	ErrNotFound = errors.New("not found")
+	ErrNotFound        = errors.New("not found")
+	ErrVersionConflict = errors.New("version conflict")
 )
 
+const maxCategories = 10000
+
 type Repository interface {
 	Close()
 	GetProductByID(ctx context.Context, id string) (*Product, error)
-	ListProducts(ctx context.Context, skip uint64, take uint64) ([]*Product, error)
+	ListProducts(ctx context.Context, filter ProductFilter, skip uint64, take uint64) ([]*Product, error)
+	ListProductsInCategory(ctx context.Context, categoryID string) ([]*Product, error)
+	ScrollProducts(ctx context.Context, filter ProductFilter, fn func([]*Product) error) error
 	ListProductsWithIDs(ctx context.Context, ids []string) ([]*Product, error)
-	SearchProducts(ctx context.Context, query string, skip uint64, take uint64) ([]*Product, error)
+	SearchProducts(ctx context.Context, query string, filter ProductFilter, skip uint64, take uint64) (*SearchResult, error)
+	SuggestProducts(ctx context.Context, prefix string, size int) ([]*Suggestion, error)
 	PutProduct(ctx context.Context, p *Product) error
+	ImportProducts(ctx context.Context, products []*Product) ([]ImportResult, error)
+	UpdateProduct(ctx context.Context, p *Product) error
+	DeleteProduct(ctx context.Context, id string, version int64) error
+	GetStock(ctx context.Context, productID string) (*Stock, error)
+	ListStock(ctx context.Context, productIDs []string) ([]*Stock, error)
+	PutStock(ctx context.Context, s *Stock) error
+	GetCategoryByID(ctx context.Context, id string) (*Category, error)
+	ListCategories(ctx context.Context) ([]*Category, error)
+	PutCategory(ctx context.Context, c *Category) error
+	DeleteCategory(ctx context.Context, id string) error
 }
 
 type ElasticRepository struct {
@@ -27,9 +48,78 @@ type ElasticRepository struct {
 }
 
 type ProductDocument struct {
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	Price        int64     `json:"price"`
+	Currency     string    `json:"currency"`
+	Categories   []string  `json:"categories"`
+	CategoryPath []string  `json:"categoryPath"`
+	CreatedAt    time.Time `json:"createdAt"`
+	// Variants are mapped as nested documents so that a query on several
+	// variant attributes matches them within the same variant.
+	Variants []VariantDocument `json:"variants"`
+	// Suggest feeds the completion suggester behind SuggestProducts.
+	Suggest SuggestField `json:"suggest"`
+}
+
+// VariantDocument stores a price override in the product's currency.
+type VariantDocument struct {
+	SKU        string            `json:"sku"`
+	Attributes map[string]string `json:"attributes"`
+	Price      *int64            `json:"price,omitempty"`
+	Active     bool              `json:"active"`
+}
+
+type SuggestField struct {
+	Input []string `json:"input"`
+}
+
+// productMapping declares the fields that dynamic mapping cannot infer.
+// Prices are declared so that a first document with a round price cannot
+// leave them mapped as anything but integers.
+var productMapping = map[string]interface{}{
+	"properties": map[string]interface{}{
+		"price": map[string]interface{}{"type": "long"},
+		"suggest": map[string]interface{}{
+			"type": "completion",
+		},
+		"variants": map[string]interface{}{
+			"type": "nested",
+			"properties": map[string]interface{}{
+				"sku":   map[string]interface{}{"type": "keyword"},
+				"price": map[string]interface{}{"type": "long"},
+			},
+		},
+	},
+}
+
+// Products are read and written through the "catalog" alias, which points at
+// catalogIndex. Before prices were kept in minor units "catalog" was the index
+// itself, with prices mapped as floats.
+const catalogIndex = "catalog_v2"
+
+// legacyPriceScript converts the float dollar prices of documents indexed
+// before prices were kept in minor units, which have no currency.
+const legacyPriceScript = `if (ctx._source.currency == null) {
+	ctx._source.currency = 'USD';
+	if (ctx._source.price != null) {
+		ctx._source.price = Math.round(ctx._source.price * 100);
+	}
+}`
+
+type CategoryDocument struct {
+	Name     string   `json:"name"`
+	ParentID string   `json:"parentId"`
+	Path     []string `json:"path"`
+}
+
+// StockDocument is stored as type "stock" in its own "inventory" index
+// rather than as a second type in "catalog". The elastic.v5 client still
+// addresses documents by type, but the Elasticsearch 6.2 server in
+// docker-compose.yaml rejects a second type in an existing index.
+type StockDocument struct {
+	OnHand       int64         `json:"onHand"`
+	Reservations []Reservation `json:"reservations"`
 }
 
 func NewElasticRepository(url string) (Repository, error) {
@@ -42,9 +132,94 @@ func NewElasticRepository(url string) (Repository, error) {
 		return nil, err
 	}
 
+	if err := putMappings(context.Background(), client); err != nil {
+		return nil, err
+	}
+
 	return &ElasticRepository{client: client}, nil
 }
 
+// putMappings creates the catalog index with its mapping, or adds new fields
+// to the mapping of an existing index. Documents indexed before a field was
+// mapped only gain it when they are next written. An index that still maps
+// prices as floats is reindexed first.
+func putMappings(ctx context.Context, client *elastic.Client) error {
+	exists, err := client.IndexExists("catalog").Do(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		_, err = client.CreateIndex(catalogIndex).
+			BodyJson(map[string]interface{}{
+				"mappings": map[string]interface{}{"product": productMapping},
+				"aliases":  map[string]interface{}{"catalog": map[string]interface{}{}},
+			}).
+			Do(ctx)
+		return err
+	}
+
+	mappings, err := client.GetMapping().Index("catalog").Type("product").Do(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := mappings[catalogIndex]; !ok {
+		return reindexCatalog(ctx, client)
+	}
+
+	_, err = client.PutMapping().
+		Index("catalog").
+		Type("product").
+		BodyJson(productMapping).
+		Do(ctx)
+	return err
+}
+
+// reindexCatalog copies the products of the old "catalog" index into
+// catalogIndex, converting legacy prices, and replaces the old index with
+// the alias. Versions are carried over so that clients holding one can still
+// update. Products written to the old index while it runs are lost, so it
+// runs when the service starts, before it takes requests.
+func reindexCatalog(ctx context.Context, client *elastic.Client) error {
+	log.Println("Reindexing catalog into", catalogIndex)
+
+	exists, err := client.IndexExists(catalogIndex).Do(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		_, err = client.CreateIndex(catalogIndex).
+			BodyJson(map[string]interface{}{
+				"mappings": map[string]interface{}{"product": productMapping},
+			}).
+			Do(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	res, err := client.Reindex().
+		SourceIndex("catalog").
+		Destination(elastic.NewReindexDestination().Index(catalogIndex).VersionType("external")).
+		Script(elastic.NewScript(legacyPriceScript)).
+		// Products already copied by an interrupted run are kept.
+		ProceedOnVersionConflict().
+		WaitForCompletion(true).
+		Refresh("true").
+		Do(ctx)
+	if err != nil {
+		return err
+	}
+	if len(res.Failures) > 0 {
+		return fmt.Errorf("reindexing catalog: %d of %d products failed", len(res.Failures), res.Total)
+	}
+
+	if _, err := client.DeleteIndex("catalog").Do(ctx); err != nil {
+		return err
+	}
+	_, err = client.Alias().Add(catalogIndex, "catalog").Do(ctx)
+	return err
+}
+
 func (r *ElasticRepository) Close() {
 }
 
@@ -55,6 +230,9 @@ func (r *ElasticRepository) GetProductByID(ctx context.Context, id string) (*Pro
 		Id(id).
 		Do(ctx)
 
+	if elastic.IsNotFound(err) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -68,45 +246,82 @@ func (r *ElasticRepository) GetProductByID(ctx context.Context, id string) (*Pro
 		return nil, err
 	}
 
-	return &Product{
-		ID:          id,
-		Name:        p.Name,
-		Description: p.Description,
-		Price:       p.Price,
-	}, nil
+	return p.product(id, res.Version), nil
 }
 
-func (r *ElasticRepository) ListProducts(ctx context.Context, skip uint64, take uint64) ([]*Product, error) {
+func (r *ElasticRepository) ListProducts(ctx context.Context, filter ProductFilter, skip uint64, take uint64) ([]*Product, error) {
 	res, err := r.client.Search().
 		Index("catalog").
 		Type("product").
-		Query(elastic.NewMatchAllQuery()).
+		Query(filterQuery(elastic.NewBoolQuery().Must(elastic.NewMatchAllQuery()), filter)).
+		SortBy(sorters(filter.Sort)...).
+		Version(true).
 		From(int(skip)).
 		Size(int(take)).
 		Do(ctx)
 
 	if err != nil {
-		log.Fatal(err)
 		return nil, err
 	}
 
 	products := []*Product{}
-
 	for _, hit := range res.Hits.Hits {
 		p := ProductDocument{}
 		if err := json.Unmarshal(*hit.Source, &p); err == nil {
-			products = append(products, &Product{
-				ID:          hit.Id,
-				Name:        p.Name,
-				Description: p.Description,
-				Price:       p.Price,
-			})
+			products = append(products, p.product(hit.Id, hit.Version))
 		}
 	}
 
 	return products, nil
 }
 
+// ListProductsInCategory returns every product filed under the category or
+// one of its descendants, scrolling past the search window limit.
+func (r *ElasticRepository) ListProductsInCategory(ctx context.Context, categoryID string) ([]*Product, error) {
+	products := []*Product{}
+	err := r.ScrollProducts(ctx, ProductFilter{CategoryID: categoryID}, func(page []*Product) error {
+		products = append(products, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// ScrollProducts calls fn with successive pages of every product matching
+// the filter, stopping at the first error fn returns. The filter's sort is
+// ignored.
+func (r *ElasticRepository) ScrollProducts(ctx context.Context, filter ProductFilter, fn func([]*Product) error) error {
+	scroll := r.client.Scroll("catalog").
+		Type("product").
+		Query(filterQuery(elastic.NewBoolQuery(), filter)).
+		Version(true).
+		Size(500)
+	defer scroll.Clear(context.Background())
+
+	for {
+		res, err := scroll.Do(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		products := []*Product{}
+		for _, hit := range res.Hits.Hits {
+			p := ProductDocument{}
+			if err := json.Unmarshal(*hit.Source, &p); err == nil {
+				products = append(products, p.product(hit.Id, hit.Version))
+			}
+		}
+		if err := fn(products); err != nil {
+			return err
+		}
+	}
+}
+
 func (r *ElasticRepository) ListProductsWithIDs(ctx context.Context, ids []string) ([]*Product, error) {
 	items := []*elastic.MultiGetItem{}
 	for _, id := range ids {
@@ -129,14 +344,12 @@ func (r *ElasticRepository) ListProductsWithIDs(ctx context.Context, ids []strin
 	products := []*Product{}
 
 	for _, doc := range res.Docs {
+		if !doc.Found {
+			continue
+		}
 		p := ProductDocument{}
 		if err := json.Unmarshal(*doc.Source, &p); err == nil {
-			products = append(products, &Product{
-				ID:          doc.Id,
-				Name:        p.Name,
-				Description: p.Description,
-				Price:       p.Price,
-			})
+			products = append(products, p.product(doc.Id, doc.Version))
 		}
 
 	}
@@ -144,47 +357,643 @@ func (r *ElasticRepository) ListProductsWithIDs(ctx context.Context, ids []strin
 	return products, nil
 }
 
-func (r *ElasticRepository) SearchProducts(ctx context.Context, query string, skip uint64, take uint64) ([]*Product, error) {
-	res, err := r.client.Search().
+// SearchProducts returns a page of matches together with facet counts over
+// every match, not just the page.
+func (r *ElasticRepository) SearchProducts(ctx context.Context, query string, filter ProductFilter, skip uint64, take uint64) (*SearchResult, error) {
+	search := r.client.Search().
 		Index("catalog").
 		Type("product").
-		Query(elastic.NewMultiMatchQuery(query, "name", "description")).
+		Query(filterQuery(elastic.NewBoolQuery().Must(elastic.NewMultiMatchQuery(query, "name", "description")), filter)).
+		SortBy(sorters(filter.Sort)...).
+		Version(true).
 		From(int(skip)).
 		Size(int(take)).
-		Do(ctx)
+		Aggregation("price", elastic.NewTermsAggregation().
+			Field("currency.keyword").
+			SubAggregation("histogram", elastic.NewHistogramAggregation().
+				Field("price").
+				Interval(priceBucketWidth).
+				MinDocCount(1)))
+	for _, field := range termFacets {
+		search = search.Aggregation(field, elastic.NewTermsAggregation().Field(field+".keyword"))
+	}
+	attributes, err := r.attributeFields(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(attributes) > 0 {
+		// Variants are nested documents, so each value is counted by the
+		// products above its variants rather than by the variants.
+		active := elastic.NewFilterAggregation().Filter(elastic.NewTermQuery("variants.active", true))
+		for _, a := range attributes {
+			active = active.SubAggregation(a.name, elastic.NewTermsAggregation().
+				Field(a.field).
+				Size(termFacetSize).
+				OrderByAggregation("products", false).
+				OrderByTermAsc().
+				SubAggregation("products", elastic.NewReverseNestedAggregation()))
+		}
+		search = search.Aggregation("variants", elastic.NewNestedAggregation().
+			Path("variants").
+			SubAggregation("active", active))
+	}
 
+	res, err := search.Do(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	products := []*Product{}
+	result := &SearchResult{
+		Products: []*Product{},
+		Total:    res.TotalHits(),
+		Facets: Facets{
+			Price: []PriceBucket{},
+			Terms: []TermFacet{},
+		},
+	}
 	for _, hit := range res.Hits.Hits {
 		p := ProductDocument{}
 		if err := json.Unmarshal(*hit.Source, &p); err == nil {
-			products = append(products, &Product{
-				ID:          hit.Id,
-				Name:        p.Name,
-				Description: p.Description,
-				Price:       p.Price,
-			})
+			result.Products = append(result.Products, p.product(hit.Id, hit.Version))
 		}
 	}
 
-	return products, nil
+	if currencies, ok := res.Aggregations.Terms("price"); ok {
+		for _, c := range currencies.Buckets {
+			currency, _ := c.Key.(string)
+			histogram, ok := c.Histogram("histogram")
+			if !ok {
+				continue
+			}
+			for _, b := range histogram.Buckets {
+				result.Facets.Price = append(result.Facets.Price, PriceBucket{
+					From:  money.New(int64(b.Key), currency),
+					To:    money.New(int64(b.Key)+priceBucketWidth, currency),
+					Count: b.DocCount,
+				})
+			}
+		}
+	}
+	for _, field := range termFacets {
+		terms, ok := res.Aggregations.Terms(field)
+		if !ok {
+			continue
+		}
+		facet := TermFacet{Field: field, Buckets: []TermBucket{}}
+		for _, b := range terms.Buckets {
+			value, _ := b.Key.(string)
+			facet.Buckets = append(facet.Buckets, TermBucket{Value: value, Count: b.DocCount})
+		}
+		result.Facets.Terms = append(result.Facets.Terms, facet)
+	}
+	if variants, ok := res.Aggregations.Nested("variants"); ok {
+		if active, ok := variants.Filter("active"); ok {
+			for _, a := range attributes {
+				terms, ok := active.Terms(a.name)
+				if !ok || len(terms.Buckets) == 0 {
+					continue
+				}
+				facet := TermFacet{Field: attributeFacetPrefix + a.name, Buckets: []TermBucket{}}
+				for _, b := range terms.Buckets {
+					value, _ := b.Key.(string)
+					count := int64(0)
+					if products, ok := b.ReverseNested("products"); ok {
+						count = products.DocCount
+					}
+					facet.Buckets = append(facet.Buckets, TermBucket{Value: value, Count: count})
+				}
+				result.Facets.Terms = append(result.Facets.Terms, facet)
+			}
+		}
+	}
 
+	return result, nil
+}
+
+type attributeField struct {
+	name  string
+	field string
+}
+
+// attributeFields returns the variant attributes that have a keyword field in
+// the catalog mapping, ordered by name. Attributes are mapped dynamically, so
+// the mapping is the only list of them.
+func (r *ElasticRepository) attributeFields(ctx context.Context) ([]attributeField, error) {
+	mappings, err := r.client.GetMapping().Index("catalog").Type("product").Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]string{}
+	for _, index := range mappings {
+		properties := mappingProperties(index, "mappings", "product", "properties", "variants", "properties", "attributes", "properties")
+		for name, property := range properties {
+			p, _ := property.(map[string]interface{})
+			switch p["type"] {
+			case "keyword":
+				fields[name] = "variants.attributes." + name
+			case "text":
+				if mappingProperties(p, "fields", "keyword") != nil {
+					fields[name] = "variants.attributes." + name + ".keyword"
+				}
+			}
+		}
+	}
+
+	attributes := []attributeField{}
+	for name, field := range fields {
+		attributes = append(attributes, attributeField{name: name, field: field})
+	}
+	sort.Slice(attributes, func(i, j int) bool { return attributes[i].name < attributes[j].name })
+	return attributes, nil
+}
+
+// mappingProperties follows path through a decoded mapping, returning nil if
+// any step is missing.
+func mappingProperties(m interface{}, path ...string) map[string]interface{} {
+	for _, key := range path {
+		object, ok := m.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		m = object[key]
+	}
+	object, _ := m.(map[string]interface{})
+	return object
+}
+
+// SuggestProducts completes prefix against product names, best match first.
+func (r *ElasticRepository) SuggestProducts(ctx context.Context, prefix string, size int) ([]*Suggestion, error) {
+	res, err := r.client.Search().
+		Index("catalog").
+		Type("product").
+		Suggester(elastic.NewCompletionSuggester("name").
+			Field("suggest").
+			Prefix(prefix).
+			Size(size)).
+		FetchSourceContext(elastic.NewFetchSourceContext(true).Include("name")).
+		Size(0).
+		Do(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := []*Suggestion{}
+	for _, s := range res.Suggest["name"] {
+		for _, option := range s.Options {
+			p := ProductDocument{}
+			if option.Source == nil || json.Unmarshal(*option.Source, &p) != nil {
+				continue
+			}
+			suggestions = append(suggestions, &Suggestion{
+				ProductID: option.Id,
+				Name:      p.Name,
+				Score:     option.ScoreUnderscore,
+			})
+		}
+	}
+
+	return suggestions, nil
 }
 
 func (r *ElasticRepository) PutProduct(ctx context.Context, p *Product) error {
-	_, err := r.client.Index().
+	res, err := r.client.Index().
+		Index("catalog").
+		Type("product").
+		Id(p.ID).
+		BodyJson(productDocument(p)).
+		Do(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	p.Version = res.Version
+	return nil
+}
+
+// ImportProducts writes the products in one bulk request. Each product
+// replaces the stored one but keeps its creation time, or is created if it
+// does not exist. The results are in the order of products; a row that
+// Elasticsearch rejects only fails that row.
+func (r *ElasticRepository) ImportProducts(ctx context.Context, products []*Product) ([]ImportResult, error) {
+	bulk := r.client.Bulk()
+	for _, p := range products {
+		doc := productDocument(p)
+		update, err := documentFields(doc)
+		if err != nil {
+			return nil, err
+		}
+		delete(update, "createdAt")
+
+		bulk.Add(elastic.NewBulkUpdateRequest().
+			Index("catalog").
+			Type("product").
+			Id(p.ID).
+			Doc(update).
+			Upsert(doc))
+	}
+
+	res, err := bulk.Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []ImportResult{}
+	for i, item := range res.Items {
+		result := ImportResult{ID: products[i].ID}
+		for _, op := range item {
+			if op.Error != nil {
+				result.Err = fmt.Errorf("%s: %s", op.Error.Type, op.Error.Reason)
+			}
+			result.Created = op.Result == "created"
+			products[i].Version = op.Version
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// UpdateProduct replaces the product document only if it is still at
+// p.Version, and sets p.Version to the new version on success.
+func (r *ElasticRepository) UpdateProduct(ctx context.Context, p *Product) error {
+	res, err := r.client.Index().
 		Index("catalog").
 		Type("product").
 		Id(p.ID).
-		BodyJson(ProductDocument{
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
+		Version(p.Version).
+		BodyJson(productDocument(p)).
+		Do(ctx)
+
+	if elastic.IsConflict(err) {
+		return ErrVersionConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	p.Version = res.Version
+	return nil
+}
+
+// DeleteProduct removes the product if it is still at version. A zero
+// version deletes whatever version is current.
+func (r *ElasticRepository) DeleteProduct(ctx context.Context, id string, version int64) error {
+	req := r.client.Delete().
+		Index("catalog").
+		Type("product").
+		Id(id)
+	if version != 0 {
+		req = req.Version(version)
+	}
+
+	_, err := req.Do(ctx)
+	if elastic.IsNotFound(err) {
+		return ErrNotFound
+	}
+	if elastic.IsConflict(err) {
+		return ErrVersionConflict
+	}
+	return err
+}
+
+// GetStock returns the product's stock. A product that has never been
+// stocked has an empty Stock with a zero version.
+func (r *ElasticRepository) GetStock(ctx context.Context, productID string) (*Stock, error) {
+	res, err := r.client.Get().
+		Index("inventory").
+		Type("stock").
+		Id(productID).
+		Do(ctx)
+
+	if elastic.IsNotFound(err) {
+		return &Stock{ProductID: productID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !res.Found {
+		return &Stock{ProductID: productID}, nil
+	}
+
+	d := StockDocument{}
+	if err := json.Unmarshal(*res.Source, &d); err != nil {
+		return nil, err
+	}
+
+	return &Stock{
+		ProductID:    productID,
+		OnHand:       d.OnHand,
+		Reservations: d.Reservations,
+		Version:      versionOf(res.Version),
+	}, nil
+}
+
+func (r *ElasticRepository) ListStock(ctx context.Context, productIDs []string) ([]*Stock, error) {
+	items := []*elastic.MultiGetItem{}
+	for _, id := range productIDs {
+		items = append(items,
+			elastic.NewMultiGetItem().
+				Index("inventory").
+				Type("stock").
+				Id(id),
+		)
+	}
+
+	res, err := r.client.MultiGet().
+		Add(items...).
+		Do(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	stocks := []*Stock{}
+	for _, doc := range res.Docs {
+		if !doc.Found {
+			continue
+		}
+		d := StockDocument{}
+		if err := json.Unmarshal(*doc.Source, &d); err == nil {
+			stocks = append(stocks, &Stock{
+				ProductID:    doc.Id,
+				OnHand:       d.OnHand,
+				Reservations: d.Reservations,
+				Version:      versionOf(doc.Version),
+			})
+		}
+	}
+
+	return stocks, nil
+}
+
+// PutStock writes the stock only if it is still at s.Version; a zero version
+// only succeeds if no stock document exists yet.
+func (r *ElasticRepository) PutStock(ctx context.Context, s *Stock) error {
+	req := r.client.Index().
+		Index("inventory").
+		Type("stock").
+		Id(s.ProductID).
+		BodyJson(StockDocument{
+			OnHand:       s.OnHand,
+			Reservations: s.Reservations,
+		})
+	if s.Version == 0 {
+		req = req.OpType("create")
+	} else {
+		req = req.Version(s.Version)
+	}
+
+	res, err := req.Do(ctx)
+	if elastic.IsConflict(err) {
+		return ErrVersionConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	s.Version = res.Version
+	return nil
+}
+
+func (r *ElasticRepository) GetCategoryByID(ctx context.Context, id string) (*Category, error) {
+	res, err := r.client.Get().
+		Index("categories").
+		Type("category").
+		Id(id).
+		Do(ctx)
+
+	if elastic.IsNotFound(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !res.Found {
+		return nil, ErrNotFound
+	}
+
+	d := CategoryDocument{}
+	if err := json.Unmarshal(*res.Source, &d); err != nil {
+		return nil, err
+	}
+
+	return &Category{
+		ID:       id,
+		Name:     d.Name,
+		ParentID: d.ParentID,
+		Path:     d.Path,
+	}, nil
+}
+
+// ListCategories returns the whole tree. Category trees are small, so this
+// is a single page of up to maxCategories.
+func (r *ElasticRepository) ListCategories(ctx context.Context) ([]*Category, error) {
+	res, err := r.client.Search().
+		Index("categories").
+		Type("category").
+		Query(elastic.NewMatchAllQuery()).
+		Size(maxCategories).
+		Do(ctx)
+
+	if elastic.IsNotFound(err) {
+		return []*Category{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	categories := []*Category{}
+	for _, hit := range res.Hits.Hits {
+		d := CategoryDocument{}
+		if err := json.Unmarshal(*hit.Source, &d); err == nil {
+			categories = append(categories, &Category{
+				ID:       hit.Id,
+				Name:     d.Name,
+				ParentID: d.ParentID,
+				Path:     d.Path,
+			})
+		}
+	}
+
+	return categories, nil
+}
+
+func (r *ElasticRepository) PutCategory(ctx context.Context, c *Category) error {
+	_, err := r.client.Index().
+		Index("categories").
+		Type("category").
+		Id(c.ID).
+		BodyJson(CategoryDocument{
+			Name:     c.Name,
+			ParentID: c.ParentID,
+			Path:     c.Path,
 		}).
+		Refresh("wait_for").
+		Do(ctx)
+
+	return err
+}
+
+func (r *ElasticRepository) DeleteCategory(ctx context.Context, id string) error {
+	_, err := r.client.Delete().
+		Index("categories").
+		Type("category").
+		Id(id).
+		Refresh("wait_for").
 		Do(ctx)
 
+	if elastic.IsNotFound(err) {
+		return ErrNotFound
+	}
 	return err
 }
+
+func productDocument(p *Product) ProductDocument {
+	return ProductDocument{
+		Name:         p.Name,
+		Description:  p.Description,
+		Price:        p.Price.Amount,
+		Currency:     p.Price.Currency,
+		Categories:   p.CategoryIDs,
+		CategoryPath: p.CategoryPath,
+		CreatedAt:    p.CreatedAt,
+		Variants:     variantDocuments(p.Variants),
+		Suggest:      SuggestField{Input: suggestInputs(p.Name)},
+	}
+}
+
+// documentFields turns a document into the map of its fields, for partial
+// updates that leave some fields alone.
+func documentFields(doc interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func variantDocuments(variants []Variant) []VariantDocument {
+	docs := []VariantDocument{}
+	for _, v := range variants {
+		d := VariantDocument{
+			SKU:        v.SKU,
+			Attributes: v.Attributes,
+			Active:     v.Active,
+		}
+		if v.Price != nil {
+			d.Price = &v.Price.Amount
+		}
+		docs = append(docs, d)
+	}
+	return docs
+}
+
+// UnmarshalJSON also reads documents indexed before prices were kept in minor
+// units. Those have no currency and a decimal price in US dollars.
+func (d *ProductDocument) UnmarshalJSON(data []byte) error {
+	type document ProductDocument
+	doc := struct {
+		document
+		Price json.Number `json:"price"`
+	}{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	*d = ProductDocument(doc.document)
+	if doc.Price == "" {
+		return nil
+	}
+
+	if doc.Currency != "" {
+		price, err := doc.Price.Int64()
+		if err != nil {
+			return err
+		}
+		d.Price = price
+		return nil
+	}
+
+	price, err := money.Parse(doc.Price.String(), money.DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	d.Price = price.Amount
+	d.Currency = price.Currency
+	return nil
+}
+
+func (d ProductDocument) product(id string, version *int64) *Product {
+	p := &Product{
+		ID:           id,
+		Name:         d.Name,
+		Description:  d.Description,
+		Price:        money.New(d.Price, d.Currency),
+		CategoryIDs:  d.Categories,
+		CategoryPath: d.CategoryPath,
+		CreatedAt:    d.CreatedAt,
+		Version:      versionOf(version),
+	}
+	for _, v := range d.Variants {
+		variant := Variant{
+			SKU:        v.SKU,
+			Attributes: v.Attributes,
+			Active:     v.Active,
+		}
+		if v.Price != nil {
+			price := money.New(*v.Price, d.Currency)
+			variant.Price = &price
+		}
+		p.Variants = append(p.Variants, variant)
+	}
+	return p
+}
+
+// filterQuery adds the filter's clauses to q. IDs and currency codes are
+// matched on keyword sub-fields, since the analyzed fields are lowercased.
+func filterQuery(q *elastic.BoolQuery, filter ProductFilter) *elastic.BoolQuery {
+	if filter.CategoryID != "" {
+		q = q.Filter(elastic.NewTermQuery("categoryPath.keyword", filter.CategoryID))
+	}
+	if filter.MinPrice != nil || filter.MaxPrice != nil {
+		price := elastic.NewRangeQuery("price")
+		currency := ""
+		if filter.MinPrice != nil {
+			price = price.Gte(filter.MinPrice.Amount)
+			currency = filter.MinPrice.Currency
+		}
+		if filter.MaxPrice != nil {
+			price = price.Lte(filter.MaxPrice.Amount)
+			currency = filter.MaxPrice.Currency
+		}
+		q = q.Filter(price, elastic.NewTermQuery("currency.keyword", currency))
+	}
+	return q
+}
+
+// sorters orders results by the requested sort, falling back to relevance
+// so that ties in a text search still rank by score.
+func sorters(sort Sort) []elastic.Sorter {
+	switch sort {
+	case SortPriceAsc:
+		return []elastic.Sorter{elastic.NewFieldSort("price").Asc(), elastic.NewScoreSort()}
+	case SortPriceDesc:
+		return []elastic.Sorter{elastic.NewFieldSort("price").Desc(), elastic.NewScoreSort()}
+	case SortNewest:
+		return []elastic.Sorter{elastic.NewFieldSort("createdAt").Desc().Missing("_last"), elastic.NewScoreSort()}
+	default:
+		return []elastic.Sorter{elastic.NewScoreSort()}
+	}
+}
+
+func versionOf(v *int64) int64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
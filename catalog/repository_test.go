@@ -0,0 +1,400 @@
+package catalog
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+
+	"github.com/jaykapade/cart-microservice/money"
+	"github.com/segmentio/ksuid"
+)
+
+// TestRepositoryParity runs the same cases against both repositories, so
+// switching the backend does not change what clients see. Each backend is
+// skipped unless its URL is set. The fixtures are named with a word unique to
+// the run, so the cases can share a database with other data.
+func TestRepositoryParity(t *testing.T) {
+	backends := []struct {
+		name string
+		env  string
+		open func(url string) (Repository, error)
+	}{
+		{"elasticsearch", "ELASTICSEARCH_URL", NewElasticRepository},
+		{"postgres", "DATABASE_URL", NewPostgresRepository},
+	}
+
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			url := os.Getenv(b.env)
+			if url == "" {
+				t.Skipf("%s is not set", b.env)
+			}
+			r, err := b.open(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Cleanups run last first, so the fixtures are deleted before
+			// the repository is closed.
+			t.Cleanup(r.Close)
+			testRepository(t, r)
+		})
+	}
+}
+
+func testRepository(t *testing.T, r Repository) {
+	ctx := context.Background()
+	tag := uniqueWord()
+	category := ksuid.New().String()
+	subcategory := ksuid.New().String()
+	created := time.Now().UTC().Truncate(time.Second)
+	variantPrice := money.New(1700, "USD")
+
+	products := []*Product{
+		{
+			Name:         "Linen shirt " + tag,
+			Description:  "A light summer shirt",
+			Price:        money.New(500, "USD"),
+			CategoryIDs:  []string{subcategory},
+			CategoryPath: []string{category, subcategory},
+			CreatedAt:    created.Add(-4 * time.Hour),
+		},
+		{
+			Name:         "Wool sweater " + tag,
+			Description:  "A warm winter sweater",
+			Price:        money.New(1500, "USD"),
+			CategoryIDs:  []string{category},
+			CategoryPath: []string{category},
+			Variants: []Variant{
+				{SKU: tag + "-s", Attributes: map[string]string{"size": "S"}, Active: true},
+				{SKU: tag + "-m", Attributes: map[string]string{"size": "M"}, Price: &variantPrice},
+			},
+			CreatedAt: created.Add(-3 * time.Hour),
+		},
+		{
+			Name:         "Cotton scarf " + tag,
+			Description:  "A soft scarf",
+			Price:        money.New(1800, "USD"),
+			CategoryIDs:  []string{category},
+			CategoryPath: []string{category},
+			CreatedAt:    created.Add(-2 * time.Hour),
+		},
+		{
+			Name:        "Leather belt " + tag,
+			Description: "A brown belt",
+			Price:       money.New(2500, "EUR"),
+			CreatedAt:   created.Add(-1 * time.Hour),
+		},
+	}
+	for _, p := range products {
+		p.ID = ksuid.New().String()
+		if err := r.PutProduct(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+		id := p.ID
+		t.Cleanup(func() { r.DeleteProduct(context.Background(), id, 0) })
+	}
+	refresh(t, r)
+
+	t.Run("get", func(t *testing.T) {
+		for _, want := range products {
+			got, err := r.GetProductByID(ctx, want.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertProduct(t, got, want)
+		}
+
+		if _, err := r.GetProductByID(ctx, ksuid.New().String()); err != ErrNotFound {
+			t.Errorf("GetProductByID of a missing product = %v; want %v", err, ErrNotFound)
+		}
+	})
+
+	t.Run("list by ids", func(t *testing.T) {
+		got, err := r.ListProductsWithIDs(ctx, []string{products[2].ID, products[0].ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIDs(t, got, products[2], products[0])
+	})
+
+	t.Run("update", func(t *testing.T) {
+		p, err := r.GetProductByID(ctx, products[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stale := *p
+		version := p.Version
+
+		p.Description = "A light linen shirt"
+		if err := r.UpdateProduct(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+		if p.Version != version+1 {
+			t.Errorf("version after update = %d; want %d", p.Version, version+1)
+		}
+
+		stale.Description = "A lost update"
+		if err := r.UpdateProduct(ctx, &stale); err != ErrVersionConflict {
+			t.Errorf("UpdateProduct at a stale version = %v; want %v", err, ErrVersionConflict)
+		}
+
+		got, err := r.GetProductByID(ctx, p.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertProduct(t, got, p)
+		products[0] = p
+		refresh(t, r)
+	})
+
+	t.Run("search", func(t *testing.T) {
+		res, err := r.SearchProducts(ctx, tag, ProductFilter{}, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Total != 4 {
+			t.Errorf("total = %d; want 4", res.Total)
+		}
+		assertIDSet(t, res.Products, products...)
+
+		res, err = r.SearchProducts(ctx, tag, ProductFilter{Sort: SortPriceAsc}, 1, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Total != 4 {
+			t.Errorf("total of a page = %d; want 4", res.Total)
+		}
+		assertIDs(t, res.Products, products[1], products[2])
+
+		res, err = r.SearchProducts(ctx, uniqueWord(), ProductFilter{}, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Total != 0 || len(res.Products) != 0 {
+			t.Errorf("search for an unknown word found %d products", res.Total)
+		}
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			filter ProductFilter
+			want   []*Product
+		}{
+			{"category", ProductFilter{CategoryID: category, Sort: SortPriceDesc}, []*Product{products[2], products[1], products[0]}},
+			{"subcategory", ProductFilter{CategoryID: subcategory}, []*Product{products[0]}},
+			{"price range", ProductFilter{MinPrice: &money.Money{Amount: 1000, Currency: "USD"}, MaxPrice: &money.Money{Amount: 1800, Currency: "USD"}, Sort: SortPriceAsc}, []*Product{products[1], products[2]}},
+			{"price currency", ProductFilter{MinPrice: &money.Money{Amount: 1000, Currency: "EUR"}}, []*Product{products[3]}},
+			{"newest", ProductFilter{Sort: SortNewest}, []*Product{products[3], products[2], products[1], products[0]}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				res, err := r.SearchProducts(ctx, tag, tt.filter, 0, 10)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertIDs(t, res.Products, tt.want...)
+			})
+		}
+
+		inCategory, err := r.ListProductsInCategory(ctx, category)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertIDSet(t, inCategory, products[0], products[1], products[2])
+	})
+
+	t.Run("facets", func(t *testing.T) {
+		res, err := r.SearchProducts(ctx, tag, ProductFilter{}, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wantPrice := []PriceBucket{
+			{From: money.New(0, "USD"), To: money.New(1000, "USD"), Count: 1},
+			{From: money.New(1000, "USD"), To: money.New(2000, "USD"), Count: 2},
+			{From: money.New(2000, "EUR"), To: money.New(3000, "EUR"), Count: 1},
+		}
+		if !reflect.DeepEqual(res.Facets.Price, wantPrice) {
+			t.Errorf("price facet = %v; want %v", res.Facets.Price, wantPrice)
+		}
+
+		wantTerms := []TermFacet{
+			{Field: "categories", Buckets: []TermBucket{{Value: category, Count: 2}, {Value: subcategory, Count: 1}}},
+			// The inactive M variant is not counted.
+			{Field: "variants.attributes.size", Buckets: []TermBucket{{Value: "S", Count: 1}}},
+		}
+		if !reflect.DeepEqual(res.Facets.Terms, wantTerms) {
+			t.Errorf("term facets = %v; want %v", res.Facets.Terms, wantTerms)
+		}
+	})
+
+	t.Run("suggest", func(t *testing.T) {
+		got, err := r.SuggestProducts(ctx, tag[:10], 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, s := range got {
+			ids = append(ids, s.ProductID)
+		}
+		assertSameIDs(t, ids, products...)
+
+		got, err = r.SuggestProducts(ctx, "Sweater "+tag[:10], 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0].ProductID != products[1].ID || got[0].Name != products[1].Name {
+			t.Errorf("suggestions for a name tail = %v; want %s", got, products[1].Name)
+		}
+	})
+
+	t.Run("import", func(t *testing.T) {
+		existing := *products[3]
+		existing.Price = money.New(2700, "EUR")
+		existing.CreatedAt = created
+		added := &Product{
+			ID:          ksuid.New().String(),
+			Name:        "Canvas bag " + tag,
+			Description: "A sturdy bag",
+			Price:       money.New(900, "USD"),
+			CreatedAt:   created,
+		}
+		t.Cleanup(func() { r.DeleteProduct(context.Background(), added.ID, 0) })
+
+		results, err := r.ImportProducts(ctx, []*Product{&existing, added})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []ImportResult{{ID: existing.ID, Created: false}, {ID: added.ID, Created: true}}
+		if !reflect.DeepEqual(results, want) {
+			t.Fatalf("import results = %v; want %v", results, want)
+		}
+
+		got, err := r.GetProductByID(ctx, existing.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Importing keeps the creation time of a product that already exists.
+		existing.CreatedAt = products[3].CreatedAt
+		assertProduct(t, got, &existing)
+		if got.Version <= products[3].Version {
+			t.Errorf("version after import = %d; want more than %d", got.Version, products[3].Version)
+		}
+		products[3] = got
+
+		got, err = r.GetProductByID(ctx, added.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertProduct(t, got, added)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		p := products[2]
+		if err := r.DeleteProduct(ctx, p.ID, p.Version+1); err != ErrVersionConflict {
+			t.Errorf("DeleteProduct at a stale version = %v; want %v", err, ErrVersionConflict)
+		}
+		if err := r.DeleteProduct(ctx, p.ID, p.Version); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.GetProductByID(ctx, p.ID); err != ErrNotFound {
+			t.Errorf("GetProductByID after delete = %v; want %v", err, ErrNotFound)
+		}
+		if err := r.DeleteProduct(ctx, p.ID, 0); err != ErrNotFound {
+			t.Errorf("DeleteProduct of a missing product = %v; want %v", err, ErrNotFound)
+		}
+	})
+}
+
+// refresh makes the latest writes visible to Elasticsearch searches, which
+// otherwise only see them after the next periodic refresh.
+func refresh(t *testing.T, r Repository) {
+	t.Helper()
+	if es, ok := r.(*ElasticRepository); ok {
+		if _, err := es.client.Refresh("catalog").Do(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// uniqueWord returns a random lower-case word that analyzers keep whole.
+func uniqueWord() string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return 'a' + r - '0'
+		}
+		return unicode.ToLower(r)
+	}, ksuid.New().String())
+}
+
+func assertProduct(t *testing.T, got *Product, want *Product) {
+	t.Helper()
+	if got.ID != want.ID || got.Name != want.Name || got.Description != want.Description || got.Price != want.Price {
+		t.Errorf("product = %+v; want %+v", got, want)
+	}
+	if !sameStrings(got.CategoryIDs, want.CategoryIDs) || !sameStrings(got.CategoryPath, want.CategoryPath) {
+		t.Errorf("categories = %v %v; want %v %v", got.CategoryIDs, got.CategoryPath, want.CategoryIDs, want.CategoryPath)
+	}
+	if len(got.Variants) != len(want.Variants) || len(want.Variants) > 0 && !reflect.DeepEqual(got.Variants, want.Variants) {
+		t.Errorf("variants = %+v; want %+v", got.Variants, want.Variants)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) {
+		t.Errorf("created at = %v; want %v", got.CreatedAt, want.CreatedAt)
+	}
+	if want.Version != 0 && got.Version != want.Version {
+		t.Errorf("version = %d; want %d", got.Version, want.Version)
+	}
+}
+
+// assertIDs checks that got holds the wanted products in order.
+func assertIDs(t *testing.T, got []*Product, want ...*Product) {
+	t.Helper()
+	gotIDs, wantIDs := []string{}, []string{}
+	for _, p := range got {
+		gotIDs = append(gotIDs, p.ID)
+	}
+	for _, p := range want {
+		wantIDs = append(wantIDs, p.ID)
+	}
+	if !reflect.DeepEqual(gotIDs, wantIDs) {
+		t.Errorf("products = %v; want %v", gotIDs, wantIDs)
+	}
+}
+
+// assertIDSet checks that got holds the wanted products in any order.
+func assertIDSet(t *testing.T, got []*Product, want ...*Product) {
+	t.Helper()
+	ids := []string{}
+	for _, p := range got {
+		ids = append(ids, p.ID)
+	}
+	assertSameIDs(t, ids, want...)
+}
+
+func assertSameIDs(t *testing.T, got []string, want ...*Product) {
+	t.Helper()
+	wantIDs := []string{}
+	for _, p := range want {
+		wantIDs = append(wantIDs, p.ID)
+	}
+	if !sameStrings(got, wantIDs) {
+		t.Errorf("products = %v; want %v in any order", got, wantIDs)
+	}
+}
+
+func sameStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string{}, a...)
+	b = append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return reflect.DeepEqual(a, b)
+}
@@ -2,12 +2,19 @@ package catalog
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net"
+	"time"
 
 	"github.com/jaykapade/cart-microservice/catalog/pb"
+	"github.com/jaykapade/cart-microservice/money"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 type grpcServer struct {
@@ -31,27 +38,45 @@ func ListenGRPC(s Service, port int) error {
 
 func (s *grpcServer) GetProduct(ctx context.Context, r *pb.GetProductRequest) (*pb.GetProductResponse, error) {
 	p, err := s.service.GetProduct(ctx, r.Id)
+	if err == ErrNotFound {
+		return nil, status.Errorf(codes.NotFound, "product %s not found", r.Id)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return &pb.GetProductResponse{Product: &pb.Product{
-		Id:          p.ID,
-		Name:        p.Name,
-		Description: p.Description,
-		Price:       p.Price,
-	}}, nil
+	return &pb.GetProductResponse{Product: productToProto(p)}, nil
 }
 
 func (s *grpcServer) GetProducts(ctx context.Context, r *pb.GetProductsRequest) (*pb.GetProductsResponse, error) {
 	var res []*Product
 	var err error
+	filter := ProductFilter{
+		CategoryID: r.CategoryId,
+		Sort:       Sort(r.Sort),
+	}
+	if r.MinPrice != nil {
+		minPrice := money.FromProto(r.MinPrice)
+		filter.MinPrice = &minPrice
+	}
+	if r.MaxPrice != nil {
+		maxPrice := money.FromProto(r.MaxPrice)
+		filter.MaxPrice = &maxPrice
+	}
+
+	var search *SearchResult
 	if r.Query != "" {
-		res, err = s.service.SearchProducts(ctx, r.Query, r.Skip, r.Take)
+		search, err = s.service.SearchProducts(ctx, r.Query, filter, r.Skip, r.Take)
+		if search != nil {
+			res = search.Products
+		}
 	} else if len(r.Ids) != 0 {
 		res, err = s.service.GetProductsByIDs(ctx, r.Ids)
 	} else {
-		res, err = s.service.GetProducts(ctx, r.Skip, r.Take)
+		res, err = s.service.GetProducts(ctx, filter, r.Skip, r.Take)
+	}
+	if err == ErrInvalidFilter {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 	if err != nil {
 		return nil, err
@@ -60,27 +85,383 @@ func (s *grpcServer) GetProducts(ctx context.Context, r *pb.GetProductsRequest)
 	products := []*pb.Product{}
 
 	for _, p := range res {
-		products = append(products, &pb.Product{
-			Id:          p.ID,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
+		products = append(products, productToProto(p))
+	}
+
+	if search == nil {
+		return &pb.GetProductsResponse{Products: products}, nil
+	}
+	return &pb.GetProductsResponse{
+		Products: products,
+		Total:    search.Total,
+		Facets:   facetsToProto(search.Facets),
+	}, nil
+}
+
+func facetsToProto(f Facets) *pb.ProductFacets {
+	fp := &pb.ProductFacets{}
+	for _, b := range f.Price {
+		fp.Price = append(fp.Price, &pb.PriceBucket{
+			From:  money.ToProto(b.From),
+			To:    money.ToProto(b.To),
+			Count: b.Count,
 		})
 	}
+	for _, t := range f.Terms {
+		tp := &pb.TermFacet{Field: t.Field}
+		for _, b := range t.Buckets {
+			tp.Buckets = append(tp.Buckets, &pb.TermBucket{Value: b.Value, Count: b.Count})
+		}
+		fp.Terms = append(fp.Terms, tp)
+	}
+	return fp
+}
 
-	return &pb.GetProductsResponse{Products: products}, nil
+func (s *grpcServer) SuggestProducts(ctx context.Context, r *pb.SuggestProductsRequest) (*pb.SuggestProductsResponse, error) {
+	suggestions, err := s.service.SuggestProducts(ctx, r.Prefix, r.Size)
+	if err != nil {
+		log.Println("Error suggesting products", err)
+		return nil, errors.New("Error suggesting products")
+	}
+
+	res := &pb.SuggestProductsResponse{Suggestions: []*pb.ProductSuggestion{}}
+	for _, s := range suggestions {
+		res.Suggestions = append(res.Suggestions, &pb.ProductSuggestion{
+			ProductId: s.ProductID,
+			Name:      s.Name,
+			Score:     s.Score,
+		})
+	}
+	return res, nil
 }
 
 func (s *grpcServer) PostProduct(ctx context.Context, r *pb.PostProductRequest) (*pb.PostProductResponse, error) {
-	p, err := s.service.PostProduct(ctx, r.Name, r.Description, r.Price)
+	p, err := s.service.PostProduct(ctx, r.Name, r.Description, money.FromProto(r.Price), r.CategoryIds, variantsFromProto(r.Variants))
+	if err == ErrInvalidPrice || err == ErrInvalidCategory || err == ErrInvalidVariant {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return &pb.PostProductResponse{Product: &pb.Product{
-		Id:          p.ID,
-		Name:        p.Name,
-		Description: p.Description,
-		Price:       p.Price,
+	return &pb.PostProductResponse{Product: productToProto(p)}, nil
+}
+
+func (s *grpcServer) UpdateProduct(ctx context.Context, r *pb.UpdateProductRequest) (*pb.UpdateProductResponse, error) {
+	update := ProductUpdate{}
+	paths := r.UpdateMask.GetPaths()
+	if len(paths) == 0 {
+		if r.Name != "" {
+			paths = append(paths, "name")
+		}
+		if r.Description != "" {
+			paths = append(paths, "description")
+		}
+		if r.Price != nil {
+			paths = append(paths, "price")
+		}
+	}
+	for _, path := range paths {
+		switch path {
+		case "name":
+			update.Name = &r.Name
+		case "description":
+			update.Description = &r.Description
+		case "price":
+			price := money.FromProto(r.Price)
+			update.Price = &price
+		case "categoryIds":
+			update.CategoryIDs = &r.CategoryIds
+		case "variants":
+			variants := variantsFromProto(r.Variants)
+			update.Variants = &variants
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "unknown update mask path %q", path)
+		}
+	}
+
+	p, err := s.service.UpdateProduct(ctx, r.Id, update, r.Version)
+	switch err {
+	case nil:
+	case ErrNotFound:
+		return nil, status.Errorf(codes.NotFound, "product %s not found", r.Id)
+	case ErrInvalidPrice, ErrInvalidCategory, ErrInvalidVariant:
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case ErrVersionConflict:
+		return nil, status.Errorf(codes.Aborted, "product %s was modified concurrently", r.Id)
+	default:
+		return nil, err
+	}
+
+	return &pb.UpdateProductResponse{Product: productToProto(p)}, nil
+}
+
+func (s *grpcServer) DeleteProduct(ctx context.Context, r *pb.DeleteProductRequest) (*pb.DeleteProductResponse, error) {
+	err := s.service.DeleteProduct(ctx, r.Id, r.Version)
+	switch err {
+	case nil:
+	case ErrNotFound:
+		return nil, status.Errorf(codes.NotFound, "product %s not found", r.Id)
+	case ErrVersionConflict:
+		return nil, status.Errorf(codes.Aborted, "product %s was modified concurrently", r.Id)
+	default:
+		return nil, err
+	}
+
+	return &pb.DeleteProductResponse{}, nil
+}
+
+// ImportProducts writes the streamed rows in batches as they arrive and
+// reports per-row failures once the client closes the stream. Batches
+// written before an error stay written.
+func (s *grpcServer) ImportProducts(stream pb.CatalogService_ImportProductsServer) error {
+	ctx := stream.Context()
+	summary := &ImportSummary{}
+	batch := []*Product{}
+	row := 1
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		results, err := s.service.ImportProducts(ctx, batch)
+		if err != nil {
+			log.Println("Error importing products", err)
+			return errors.New("Error importing products")
+		}
+		summary.Add(row, results)
+		row += len(batch)
+		batch = []*Product{}
+		return nil
+	}
+
+	for {
+		r, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		batch = append(batch, &Product{
+			ID:          r.Id,
+			Name:        r.Name,
+			Description: r.Description,
+			Price:       money.FromProto(r.Price),
+			CategoryIDs: r.CategoryIds,
+			Variants:    variantsFromProto(r.Variants),
+		})
+		if len(batch) == ImportBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	res := &pb.ImportProductsResponse{
+		Created: uint32(summary.Created),
+		Updated: uint32(summary.Updated),
+		Failed:  uint32(summary.Failed),
+	}
+	for _, e := range summary.Errors {
+		res.Errors = append(res.Errors, &pb.ImportError{
+			Row:     uint32(e.Row),
+			Id:      e.ID,
+			Message: e.Message,
+		})
+	}
+	return stream.SendAndClose(res)
+}
+
+func (s *grpcServer) ExportProducts(r *pb.ExportProductsRequest, stream pb.CatalogService_ExportProductsServer) error {
+	err := s.service.ExportProducts(stream.Context(), ProductFilter{CategoryID: r.CategoryId}, func(p *Product) error {
+		return stream.Send(productToProto(p))
+	})
+	if err != nil {
+		log.Println("Error exporting products", err)
+		return errors.New("Error exporting products")
+	}
+	return nil
+}
+
+func (s *grpcServer) AdjustStock(ctx context.Context, r *pb.AdjustStockRequest) (*pb.AdjustStockResponse, error) {
+	level, err := s.service.AdjustStock(ctx, r.ProductId, r.Delta)
+	if err != nil {
+		return nil, stockError(err)
+	}
+
+	return &pb.AdjustStockResponse{Stock: &pb.StockLevel{
+		ProductId: level.ProductID,
+		OnHand:    level.OnHand,
+		Reserved:  level.Reserved,
+		Available: level.Available,
 	}}, nil
 }
+
+func (s *grpcServer) Reserve(ctx context.Context, r *pb.ReserveRequest) (*pb.ReserveResponse, error) {
+	items := []ReservationItem{}
+	for _, item := range r.Items {
+		items = append(items, ReservationItem{ProductID: item.ProductId, Quantity: item.Quantity})
+	}
+
+	expiresAt, err := s.service.Reserve(ctx, r.ReservationId, items, time.Duration(r.TtlSeconds)*time.Second)
+	if err != nil {
+		return nil, stockError(err)
+	}
+
+	res := &pb.ReserveResponse{}
+	res.ExpiresAt, _ = expiresAt.MarshalBinary()
+	return res, nil
+}
+
+func (s *grpcServer) Commit(ctx context.Context, r *pb.CommitRequest) (*pb.CommitResponse, error) {
+	if err := s.service.Commit(ctx, r.ReservationId, r.ProductIds); err != nil {
+		return nil, stockError(err)
+	}
+	return &pb.CommitResponse{}, nil
+}
+
+func (s *grpcServer) Release(ctx context.Context, r *pb.ReleaseRequest) (*pb.ReleaseResponse, error) {
+	if err := s.service.Release(ctx, r.ReservationId, r.ProductIds); err != nil {
+		return nil, stockError(err)
+	}
+	return &pb.ReleaseResponse{}, nil
+}
+
+// stockError maps inventory errors to gRPC statuses. Insufficient stock is
+// FAILED_PRECONDITION so callers can tell it apart from transient failures.
+func stockError(err error) error {
+	switch {
+	case err == ErrNotFound:
+		return status.Error(codes.NotFound, "product not found")
+	case err == ErrInvalidQuantity:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrInsufficientStock):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case err == ErrReservationNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case err == ErrVersionConflict:
+		return status.Error(codes.Aborted, "stock is being changed concurrently, try again")
+	default:
+		log.Println("Error updating stock", err)
+		return errors.New("Error updating stock")
+	}
+}
+
+func productToProto(p *Product) *pb.Product {
+	return &pb.Product{
+		Id:                p.ID,
+		Name:              p.Name,
+		Description:       p.Description,
+		Price:             money.ToProto(p.Price),
+		Version:           p.Version,
+		AvailableQuantity: p.AvailableQuantity,
+		CategoryIds:       p.CategoryIDs,
+		Variants:          variantsToProto(p.Variants),
+	}
+}
+
+func variantsToProto(variants []Variant) []*pb.Variant {
+	vps := []*pb.Variant{}
+	for _, v := range variants {
+		vp := &pb.Variant{
+			Sku:        v.SKU,
+			Attributes: v.Attributes,
+			Active:     v.Active,
+		}
+		if v.Price != nil {
+			vp.Price = money.ToProto(*v.Price)
+		}
+		vps = append(vps, vp)
+	}
+	return vps
+}
+
+func variantsFromProto(vps []*pb.Variant) []Variant {
+	variants := []Variant{}
+	for _, vp := range vps {
+		v := Variant{
+			SKU:        vp.Sku,
+			Attributes: vp.Attributes,
+			Active:     vp.Active,
+		}
+		if vp.Price != nil {
+			price := money.FromProto(vp.Price)
+			v.Price = &price
+		}
+		variants = append(variants, v)
+	}
+	return variants
+}
+
+func (s *grpcServer) GetCategories(ctx context.Context, r *pb.GetCategoriesRequest) (*pb.GetCategoriesResponse, error) {
+	categories, err := s.service.GetCategories(ctx)
+	if err != nil {
+		log.Println("Error getting categories", err)
+		return nil, errors.New("Error getting categories")
+	}
+
+	res := &pb.GetCategoriesResponse{Categories: []*pb.Category{}}
+	for _, c := range categories {
+		res.Categories = append(res.Categories, categoryToProto(c))
+	}
+	return res, nil
+}
+
+func (s *grpcServer) CreateCategory(ctx context.Context, r *pb.CreateCategoryRequest) (*pb.CreateCategoryResponse, error) {
+	c, err := s.service.CreateCategory(ctx, r.Name, r.ParentId)
+	if err == ErrInvalidCategory {
+		return nil, status.Error(codes.InvalidArgument, "category needs a name and an existing parent")
+	}
+	if err != nil {
+		log.Println("Error creating category", err)
+		return nil, errors.New("Error creating category")
+	}
+
+	return &pb.CreateCategoryResponse{Category: categoryToProto(c)}, nil
+}
+
+func (s *grpcServer) MoveCategory(ctx context.Context, r *pb.MoveCategoryRequest) (*pb.MoveCategoryResponse, error) {
+	c, err := s.service.MoveCategory(ctx, r.Id, r.ParentId)
+	switch err {
+	case nil:
+	case ErrNotFound:
+		return nil, status.Errorf(codes.NotFound, "category %s not found", r.Id)
+	case ErrInvalidCategory:
+		return nil, status.Error(codes.InvalidArgument, "parent must exist and be outside the moved category")
+	default:
+		log.Println("Error moving category", err)
+		return nil, errors.New("Error moving category")
+	}
+
+	return &pb.MoveCategoryResponse{Category: categoryToProto(c)}, nil
+}
+
+func (s *grpcServer) DeleteCategory(ctx context.Context, r *pb.DeleteCategoryRequest) (*pb.DeleteCategoryResponse, error) {
+	err := s.service.DeleteCategory(ctx, r.Id)
+	switch err {
+	case nil:
+	case ErrNotFound:
+		return nil, status.Errorf(codes.NotFound, "category %s not found", r.Id)
+	case ErrCategoryNotEmpty:
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		log.Println("Error deleting category", err)
+		return nil, errors.New("Error deleting category")
+	}
+
+	return &pb.DeleteCategoryResponse{}, nil
+}
+
+func categoryToProto(c *Category) *pb.Category {
+	return &pb.Category{
+		Id:       c.ID,
+		Name:     c.Name,
+		ParentId: c.ParentID,
+		Path:     c.Path,
+	}
+}
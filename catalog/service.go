@@ -2,23 +2,63 @@ package catalog
 
 import (
 	"context"
+	"errors"
+	"time"
 
+	"github.com/jaykapade/cart-microservice/money"
 	"github.com/segmentio/ksuid"
 )
 
+var (
+	ErrInvalidPrice = errors.New("invalid price")
+)
+
 type Service interface {
 	GetProduct(ctx context.Context, id string) (*Product, error)
-	GetProducts(ctx context.Context, skip uint64, take uint64) ([]*Product, error)
+	GetProducts(ctx context.Context, filter ProductFilter, skip uint64, take uint64) ([]*Product, error)
 	GetProductsByIDs(ctx context.Context, ids []string) ([]*Product, error)
-	SearchProducts(ctx context.Context, query string, skip uint64, take uint64) ([]*Product, error)
-	PostProduct(ctx context.Context, name string, description string, price float64) (*Product, error)
+	SearchProducts(ctx context.Context, query string, filter ProductFilter, skip uint64, take uint64) (*SearchResult, error)
+	SuggestProducts(ctx context.Context, prefix string, size uint32) ([]*Suggestion, error)
+	PostProduct(ctx context.Context, name string, description string, price money.Money, categoryIDs []string, variants []Variant) (*Product, error)
+	UpdateProduct(ctx context.Context, id string, update ProductUpdate, version int64) (*Product, error)
+	DeleteProduct(ctx context.Context, id string, version int64) error
+	ImportProducts(ctx context.Context, products []*Product) ([]ImportResult, error)
+	ExportProducts(ctx context.Context, filter ProductFilter, fn func(*Product) error) error
+	AdjustStock(ctx context.Context, productID string, delta int64) (*StockLevel, error)
+	Reserve(ctx context.Context, reservationID string, items []ReservationItem, ttl time.Duration) (time.Time, error)
+	Commit(ctx context.Context, reservationID string, productIDs []string) error
+	Release(ctx context.Context, reservationID string, productIDs []string) error
+	GetCategories(ctx context.Context) ([]*Category, error)
+	CreateCategory(ctx context.Context, name string, parentID string) (*Category, error)
+	MoveCategory(ctx context.Context, id string, parentID string) (*Category, error)
+	DeleteCategory(ctx context.Context, id string) error
 }
 
 type Product struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Price       money.Money `json:"price"`
+	CategoryIDs []string    `json:"categoryIds"`
+	Variants    []Variant   `json:"variants"`
+	// CategoryPath holds the assigned categories and all their ancestors,
+	// so that filtering on a category also finds products in subcategories.
+	CategoryPath []string  `json:"categoryPath"`
+	CreatedAt    time.Time `json:"createdAt"`
+	Version      int64     `json:"version"`
+	// AvailableQuantity is the stock not held by reservations. It is not
+	// stored with the product.
+	AvailableQuantity int64 `json:"availableQuantity"`
+}
+
+// ProductUpdate holds the fields to change in a product. Nil fields are left
+// as they are.
+type ProductUpdate struct {
+	Name        *string
+	Description *string
+	Price       *money.Money
+	CategoryIDs *[]string
+	Variants    *[]Variant
 }
 
 type CatalogService struct {
@@ -30,38 +70,135 @@ func NewCatalogService(r Repository) *CatalogService {
 }
 
 func (s *CatalogService) GetProduct(ctx context.Context, id string) (*Product, error) {
-	return s.repository.GetProductByID(ctx, id)
+	p, err := s.repository.GetProductByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.withAvailability(ctx, []*Product{p}); err != nil {
+		return nil, err
+	}
+	return p, nil
 }
 
-func (s *CatalogService) GetProducts(ctx context.Context, skip uint64, take uint64) ([]*Product, error) {
+func (s *CatalogService) GetProducts(ctx context.Context, filter ProductFilter, skip uint64, take uint64) ([]*Product, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
 	if take > 100 || skip == 0 && take == 0 {
 		take = 100
 	}
 
-	return s.repository.ListProducts(ctx, skip, take)
+	products, err := s.repository.ListProducts(ctx, filter, skip, take)
+	if err != nil {
+		return nil, err
+	}
+	return s.withAvailability(ctx, products)
 }
 
 func (s *CatalogService) GetProductsByIDs(ctx context.Context, ids []string) ([]*Product, error) {
-	return s.repository.ListProductsWithIDs(ctx, ids)
+	products, err := s.repository.ListProductsWithIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	return s.withAvailability(ctx, products)
 }
 
-func (s *CatalogService) SearchProducts(ctx context.Context, query string, skip uint64, take uint64) ([]*Product, error) {
+func (s *CatalogService) SearchProducts(ctx context.Context, query string, filter ProductFilter, skip uint64, take uint64) (*SearchResult, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
 	if take > 100 || skip == 0 && take == 0 {
 		take = 100
 	}
-	return s.repository.SearchProducts(ctx, query, skip, take)
+	result, err := s.repository.SearchProducts(ctx, query, filter, skip, take)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.withAvailability(ctx, result.Products); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
-func (s *CatalogService) PostProduct(ctx context.Context, name string, description string, price float64) (*Product, error) {
+func (s *CatalogService) PostProduct(ctx context.Context, name string, description string, price money.Money, categoryIDs []string, variants []Variant) (*Product, error) {
+	if !validPrice(price) {
+		return nil, ErrInvalidPrice
+	}
+	if err := validateVariants(price, variants); err != nil {
+		return nil, err
+	}
+	path, err := s.categoryPath(ctx, categoryIDs)
+	if err != nil {
+		return nil, err
+	}
+
 	p := Product{
-		ID:          ksuid.New().String(),
-		Name:        name,
-		Description: description,
-		Price:       price,
+		ID:           ksuid.New().String(),
+		Name:         name,
+		Description:  description,
+		Price:        price,
+		CategoryIDs:  categoryIDs,
+		CategoryPath: path,
+		Variants:     variants,
+		CreatedAt:    time.Now().UTC(),
 	}
-	err := s.repository.PutProduct(ctx, &p)
+	err = s.repository.PutProduct(ctx, &p)
 	if err != nil {
 		return nil, err
 	}
 	return &p, nil
 }
+
+// UpdateProduct applies update to the product if it is still at version. A
+// zero version updates the current version, but still fails if another
+// write lands between reading and writing the product.
+func (s *CatalogService) UpdateProduct(ctx context.Context, id string, update ProductUpdate, version int64) (*Product, error) {
+	if update.Price != nil && !validPrice(*update.Price) {
+		return nil, ErrInvalidPrice
+	}
+
+	p, err := s.repository.GetProductByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 && version != p.Version {
+		return nil, ErrVersionConflict
+	}
+
+	if update.Name != nil {
+		p.Name = *update.Name
+	}
+	if update.Description != nil {
+		p.Description = *update.Description
+	}
+	if update.Price != nil {
+		p.Price = *update.Price
+	}
+	if update.CategoryIDs != nil {
+		path, err := s.categoryPath(ctx, *update.CategoryIDs)
+		if err != nil {
+			return nil, err
+		}
+		p.CategoryIDs = *update.CategoryIDs
+		p.CategoryPath = path
+	}
+	if update.Variants != nil {
+		p.Variants = *update.Variants
+	}
+	if err := validateVariants(p.Price, p.Variants); err != nil {
+		return nil, err
+	}
+
+	if err := s.repository.UpdateProduct(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *CatalogService) DeleteProduct(ctx context.Context, id string, version int64) error {
+	return s.repository.DeleteProduct(ctx, id, version)
+}
+
+func validPrice(price money.Money) bool {
+	return price.Amount >= 0 && money.ValidCurrency(price.Currency)
+}
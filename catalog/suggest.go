@@ -0,0 +1,43 @@
+package catalog
+
+import (
+	"context"
+	"strings"
+)
+
+const (
+	defaultSuggestions = 5
+	maxSuggestions     = 20
+)
+
+// Suggestion is a product name completing a search-box prefix.
+type Suggestion struct {
+	ProductID string
+	Name      string
+	Score     float64
+}
+
+func (s *CatalogService) SuggestProducts(ctx context.Context, prefix string, size uint32) ([]*Suggestion, error) {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" {
+		return []*Suggestion{}, nil
+	}
+	if size == 0 {
+		size = defaultSuggestions
+	}
+	if size > maxSuggestions {
+		size = maxSuggestions
+	}
+	return s.repository.SuggestProducts(ctx, prefix, int(size))
+}
+
+// suggestInputs returns the name and every word-aligned tail of it, so that
+// "run" completes "Trail Running Shoes" as well as "Running Shoes".
+func suggestInputs(name string) []string {
+	words := strings.Fields(name)
+	inputs := []string{}
+	for i := range words {
+		inputs = append(inputs, strings.Join(words[i:], " "))
+	}
+	return inputs
+}
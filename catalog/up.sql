@@ -0,0 +1,49 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE TABLE IF NOT EXISTS products (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    price BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    category_ids TEXT[] NOT NULL DEFAULT '{}',
+    category_path TEXT[] NOT NULL DEFAULT '{}',
+    variants JSONB NOT NULL DEFAULT '[]',
+    suggest TEXT[] NOT NULL DEFAULT '{}',
+    search TSVECTOR NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    version BIGINT NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS products_search_idx ON products USING GIN (search);
+CREATE INDEX IF NOT EXISTS products_name_trgm_idx ON products USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS products_category_path_idx ON products USING GIN (category_path);
+CREATE INDEX IF NOT EXISTS products_currency_price_idx ON products (currency, price);
+CREATE INDEX IF NOT EXISTS products_created_at_idx ON products (created_at DESC);
+
+-- Names weigh more than descriptions when ranking full-text matches.
+CREATE OR REPLACE FUNCTION products_search_update() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search := setweight(to_tsvector('english', NEW.name), 'A') ||
+        setweight(to_tsvector('english', NEW.description), 'B');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS products_search_update ON products;
+CREATE TRIGGER products_search_update BEFORE INSERT OR UPDATE OF name, description ON products
+    FOR EACH ROW EXECUTE PROCEDURE products_search_update();
+
+CREATE TABLE IF NOT EXISTS stock (
+    product_id TEXT PRIMARY KEY,
+    on_hand BIGINT NOT NULL DEFAULT 0,
+    reservations JSONB NOT NULL DEFAULT '[]',
+    version BIGINT NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    parent_id TEXT NOT NULL DEFAULT '',
+    path TEXT[] NOT NULL DEFAULT '{}'
+);
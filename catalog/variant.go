@@ -0,0 +1,56 @@
+package catalog
+
+import (
+	"errors"
+
+	"github.com/jaykapade/cart-microservice/money"
+)
+
+var (
+	ErrInvalidVariant = errors.New("invalid variant")
+)
+
+// Variant is a purchasable option of a product, e.g. a shirt in one size and
+// color. A nil Price means the variant sells at the product's price.
+type Variant struct {
+	SKU        string            `json:"sku"`
+	Attributes map[string]string `json:"attributes"`
+	Price      *money.Money      `json:"price"`
+	Active     bool              `json:"active"`
+}
+
+// Variant returns the product's variant with the given SKU, or nil.
+func (p *Product) Variant(sku string) *Variant {
+	for i := range p.Variants {
+		if p.Variants[i].SKU == sku {
+			return &p.Variants[i]
+		}
+	}
+	return nil
+}
+
+// PriceOf returns what the variant sells for.
+func (p *Product) PriceOf(v *Variant) money.Money {
+	if v != nil && v.Price != nil {
+		return *v.Price
+	}
+	return p.Price
+}
+
+// validateVariants checks that SKUs are set and unique within the product
+// and that price overrides are in the product's currency, so every line of
+// an order can still be totalled.
+func validateVariants(price money.Money, variants []Variant) error {
+	skus := map[string]bool{}
+	for _, v := range variants {
+		if v.SKU == "" || skus[v.SKU] {
+			return ErrInvalidVariant
+		}
+		skus[v.SKU] = true
+
+		if v.Price != nil && (!validPrice(*v.Price) || v.Price.Currency != price.Currency) {
+			return ErrInvalidPrice
+		}
+	}
+	return nil
+}
@@ -9,35 +9,49 @@ type accountResolver struct {
 	server *Server
 }
 
-func (r *accountResolver) Orders(ctx context.Context, obj *Account) ([]*Order, error) {
+func (r *accountResolver) Orders(ctx context.Context, obj *Account, pagination *CursorInput, filter *OrderFilterInput) (*OrderPage, error) {
+	if err := authorizeAccount(ctx, obj.ID); err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
 	defer cancel()
 
-	orderList, err := r.server.orderClient.GetOrdersForAccount(ctx, obj.ID)
+	f, err := toOrderFilter(filter)
 	if err != nil {
 		return nil, err
 	}
 
-	var orders []*Order
-
-	for _, order := range orderList {
-		var products []*OrderedProduct
-		for _, product := range order.Products {
-			products = append(products, &OrderedProduct{
-				ID:       product.ID,
-				Name:     product.Name,
-				Price:    product.Price,
-				Quantity: int(product.Quantity),
-			})
-		}
-		orders = append(orders, &Order{
-			ID:         order.ID,
-			CreatedAt:  order.CreatedAt,
-			Products:   products,
-			TotalPrice: order.TotalPrice,
-		})
+	after, take := "", uint64(0)
+	if pagination != nil {
+		after, take = pagination.bounds()
 	}
 
-	return orders, nil
+	orderList, next, err := r.server.orderClient.GetOrdersForAccount(ctx, obj.ID, f, after, take)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
 
+	return toOrderPage(orderList, next), nil
+
+}
+
+func (r *accountResolver) Addresses(ctx context.Context, obj *Account) ([]*Address, error) {
+	if err := authorizeAccount(ctx, obj.ID); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	addressList, err := r.server.accountClient.ListAddresses(ctx, obj.ID)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	addresses := []*Address{}
+	for _, a := range addressList {
+		addresses = append(addresses, toAddress(a))
+	}
+	return addresses, nil
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var grpcErrorCodes = map[codes.Code]string{
+	codes.NotFound:           "NOT_FOUND",
+	codes.InvalidArgument:    "BAD_USER_INPUT",
+	codes.FailedPrecondition: "FAILED_PRECONDITION",
+	codes.AlreadyExists:      "ALREADY_EXISTS",
+	codes.Aborted:            "CONFLICT",
+	codes.Unauthenticated:    "UNAUTHENTICATED",
+	codes.PermissionDenied:   "FORBIDDEN",
+	codes.DeadlineExceeded:   "TIMEOUT",
+}
+
+// grpcError turns a client-facing gRPC status into a GraphQL error carrying
+// an extension code. Other errors are returned unchanged.
+func grpcError(ctx context.Context, err error) error {
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	code, ok := grpcErrorCodes[s.Code()]
+	if !ok {
+		return err
+	}
+	return gqlError(ctx, code, s.Message())
+}
+
+// gqlError returns a GraphQL error for the field being resolved, carrying
+// code as its extension code.
+func gqlError(ctx context.Context, code string, message string) error {
+	return &gqlerror.Error{
+		Path:       graphql.GetPath(ctx),
+		Message:    message,
+		Extensions: map[string]interface{}{"code": code},
+	}
+}
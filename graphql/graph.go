@@ -5,6 +5,7 @@ import (
 
 	"github.com/99designs/gqlgen/graphql"
 	"github.com/jaykapade/cart-microservice/account"
+	"github.com/jaykapade/cart-microservice/cart"
 	"github.com/jaykapade/cart-microservice/catalog"
 	"github.com/jaykapade/cart-microservice/order"
 )
@@ -13,9 +14,10 @@ type Server struct {
 	accountClient *account.Client
 	catalogClient *catalog.Client
 	orderClient   *order.Client
+	cartClient    *cart.Client
 }
 
-func NewGraphQLServer(accountUrl, catalogUrl, orderUrl string) (*Server, error) {
+func NewGraphQLServer(accountUrl, catalogUrl, orderUrl, cartUrl string) (*Server, error) {
 	accountClient, err := account.NewClient(accountUrl)
 	if err != nil {
 		return nil, err
@@ -34,10 +36,19 @@ func NewGraphQLServer(accountUrl, catalogUrl, orderUrl string) (*Server, error)
 		return nil, err
 	}
 	log.Println("order client initialized...", orderUrl)
+	cartClient, err := cart.NewClient(cartUrl)
+	if err != nil {
+		accountClient.Close()
+		catalogClient.Close()
+		orderClient.Close()
+		return nil, err
+	}
+	log.Println("cart client initialized...", cartUrl)
 	return &Server{
 		accountClient: accountClient,
 		catalogClient: catalogClient,
 		orderClient:   orderClient,
+		cartClient:    cartClient,
 	}, nil
 
 }
@@ -55,5 +66,8 @@ func (s *Server) Account() AccountResolver {
 }
 
 func (s *Server) ToExecutableSchema() graphql.ExecutableSchema {
-	return NewExecutableSchema(Config{Resolvers: s})
+	return NewExecutableSchema(Config{
+		Resolvers:  s,
+		Directives: DirectiveRoot{HasRole: hasRole},
+	})
 }
@@ -13,6 +13,7 @@ type AppConfig struct {
 	AccountUrl string `envconfig:"ACCOUNT_SERVICE_URL"`
 	CatalogUrl string `envconfig:"CATALOG_SERVICE_URL"`
 	OrderUrl   string `envconfig:"ORDER_SERVICE_URL"`
+	CartUrl    string `envconfig:"CART_SERVICE_URL"`
 }
 
 func main() {
@@ -22,12 +23,12 @@ func main() {
 		log.Fatal(err)
 	}
 
-	s, err := NewGraphQLServer(cfg.AccountUrl, cfg.CatalogUrl, cfg.OrderUrl)
+	s, err := NewGraphQLServer(cfg.AccountUrl, cfg.CatalogUrl, cfg.OrderUrl, cfg.CartUrl)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	http.Handle("/graphql", handler.GraphQL(s.ToExecutableSchema()))
+	http.Handle("/graphql", s.authenticate(handler.GraphQL(s.ToExecutableSchema())))
 	http.Handle("/playground", playground.Handler("GraphQL playground", "/graphql"))
 
 	log.Println("graphql server initialized... on port 8080")
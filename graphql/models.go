@@ -1,7 +1,408 @@
 package main
 
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jaykapade/cart-microservice/account"
+	"github.com/jaykapade/cart-microservice/cart"
+	"github.com/jaykapade/cart-microservice/catalog"
+	"github.com/jaykapade/cart-microservice/money"
+	"github.com/jaykapade/cart-microservice/order"
+)
+
 type Account struct {
-	ID     string  `json:"id"`
-	Name   string  `json:"name"`
-	Orders []Order `json:"orders"`
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	DisplayName *string   `json:"displayName"`
+	Email       *string   `json:"email"`
+	Phone       *string   `json:"phone"`
+	Role        Role      `json:"role"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+func toAccount(a *account.Account) *Account {
+	return &Account{
+		ID:          a.ID,
+		Name:        a.Name,
+		DisplayName: optionalString(a.DisplayName),
+		Email:       optionalString(a.Email),
+		Phone:       optionalString(a.Phone),
+		Role:        toRole(a.Role),
+		CreatedAt:   a.CreatedAt,
+		UpdatedAt:   a.UpdatedAt,
+	}
+}
+
+// optionalString returns nil for an empty string, which GraphQL shows as
+// null.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func toAddress(a *account.Address) *Address {
+	return &Address{
+		ID:              a.ID,
+		Label:           a.Label,
+		Recipient:       a.Recipient,
+		Line1:           a.Line1,
+		Line2:           a.Line2,
+		City:            a.City,
+		PostalCode:      a.PostalCode,
+		Country:         a.Country,
+		DefaultShipping: a.DefaultShipping,
+		DefaultBilling:  a.DefaultBilling,
+	}
+}
+
+// toAccountAddress converts the input to an address with the given ID;
+// omitted optional fields are empty.
+func toAccountAddress(id string, in AddressInput) account.Address {
+	a := account.Address{
+		ID:        id,
+		Recipient: in.Recipient,
+		Line1:     in.Line1,
+		City:      in.City,
+		Country:   in.Country,
+	}
+	if in.Label != nil {
+		a.Label = *in.Label
+	}
+	if in.Line2 != nil {
+		a.Line2 = *in.Line2
+	}
+	if in.PostalCode != nil {
+		a.PostalCode = *in.PostalCode
+	}
+	if in.DefaultShipping != nil {
+		a.DefaultShipping = *in.DefaultShipping
+	}
+	if in.DefaultBilling != nil {
+		a.DefaultBilling = *in.DefaultBilling
+	}
+	return a
+}
+
+func toRole(r account.Role) Role {
+	return Role(strings.ToUpper(string(r)))
+}
+
+func toAccountRole(r Role) account.Role {
+	return account.Role(strings.ToLower(r.String()))
+}
+
+func toProduct(p *catalog.Product) *Product {
+	return &Product{
+		ID:                p.ID,
+		Name:              p.Name,
+		Description:       p.Description,
+		Price:             toMoney(p.Price),
+		Version:           int(p.Version),
+		AvailableQuantity: int(p.AvailableQuantity),
+		CategoryIds:       p.CategoryIDs,
+		Variants:          toVariants(p),
+	}
+}
+
+func toVariants(p *catalog.Product) []*Variant {
+	variants := []*Variant{}
+	for i := range p.Variants {
+		v := &p.Variants[i]
+		variants = append(variants, &Variant{
+			Sku:        v.SKU,
+			Attributes: toAttributes(v.Attributes),
+			Price:      toMoney(p.PriceOf(v)),
+			Active:     v.Active,
+		})
+	}
+	return variants
+}
+
+// toAttributes lists attributes sorted by name, as maps have no order.
+func toAttributes(m map[string]string) []*Attribute {
+	attributes := []*Attribute{}
+	for name, value := range m {
+		attributes = append(attributes, &Attribute{Name: name, Value: value})
+	}
+	sort.Slice(attributes, func(i, j int) bool { return attributes[i].Name < attributes[j].Name })
+	return attributes
+}
+
+func toCatalogVariants(in []*VariantInput) ([]catalog.Variant, error) {
+	variants := []catalog.Variant{}
+	for _, v := range in {
+		variant := catalog.Variant{
+			SKU:        v.Sku,
+			Attributes: map[string]string{},
+			Active:     v.Active == nil || *v.Active,
+		}
+		for _, a := range v.Attributes {
+			variant.Attributes[a.Name] = a.Value
+		}
+		if v.Price != nil {
+			price, err := parseMoney(v.Price)
+			if err != nil {
+				return nil, err
+			}
+			variant.Price = &price
+		}
+		variants = append(variants, variant)
+	}
+	return variants, nil
+}
+
+func toProductSearchResult(r *catalog.SearchResult) *ProductSearchResult {
+	result := &ProductSearchResult{
+		Items: []*Product{},
+		Facets: &ProductFacets{
+			Price: []*PriceBucket{},
+			Terms: []*TermFacet{},
+		},
+		Total: int(r.Total),
+	}
+	for _, p := range r.Products {
+		result.Items = append(result.Items, toProduct(p))
+	}
+	for _, b := range r.Facets.Price {
+		result.Facets.Price = append(result.Facets.Price, &PriceBucket{
+			From:  toMoney(b.From),
+			To:    toMoney(b.To),
+			Count: int(b.Count),
+		})
+	}
+	for _, t := range r.Facets.Terms {
+		facet := &TermFacet{Field: t.Field, Buckets: []*TermBucket{}}
+		for _, b := range t.Buckets {
+			facet.Buckets = append(facet.Buckets, &TermBucket{Value: b.Value, Count: int(b.Count)})
+		}
+		result.Facets.Terms = append(result.Facets.Terms, facet)
+	}
+	return result
+}
+
+func toCategory(c *catalog.Category) *Category {
+	category := &Category{
+		ID:   c.ID,
+		Name: c.Name,
+		Path: c.Path,
+	}
+	if c.ParentID != "" {
+		category.ParentID = &c.ParentID
+	}
+	return category
+}
+
+func toOrder(o *order.Order) *Order {
+	var products []*OrderedProduct
+	for _, p := range o.Products {
+		product := &OrderedProduct{
+			ID:          p.ID,
+			Attributes:  toAttributes(p.Attributes),
+			Name:        p.Name,
+			Description: p.Description,
+			Quantity:    int(p.Quantity),
+		}
+		if p.Price != nil {
+			product.Price = toMoney(*p.Price)
+		}
+		if p.SKU != "" {
+			product.Sku = &p.SKU
+		}
+		products = append(products, product)
+	}
+
+	statusHistory := []*OrderStatusChange{}
+	for _, c := range o.StatusHistory {
+		statusHistory = append(statusHistory, &OrderStatusChange{
+			Status:    toOrderStatus(c.Status),
+			CreatedAt: c.CreatedAt,
+		})
+	}
+
+	var shippingAddress *ShippingAddress
+	if a := o.ShippingAddress; a != nil {
+		shippingAddress = &ShippingAddress{
+			AddressID:  a.AddressID,
+			Recipient:  a.Recipient,
+			Line1:      a.Line1,
+			Line2:      a.Line2,
+			City:       a.City,
+			PostalCode: a.PostalCode,
+			Country:    a.Country,
+		}
+	}
+
+	return &Order{
+		ID:              o.ID,
+		CreatedAt:       o.CreatedAt,
+		Products:        products,
+		TotalPrice:      toMoney(o.TotalPrice),
+		Status:          toOrderStatus(o.Status),
+		StatusHistory:   statusHistory,
+		ShippingAddress: shippingAddress,
+	}
+}
+
+func toOrderStatus(s order.Status) OrderStatus {
+	return OrderStatus(strings.ToUpper(string(s)))
+}
+
+func toMoney(m money.Money) *Money {
+	return &Money{
+		Amount:   m.String(),
+		Currency: m.Currency,
+	}
+}
+
+func toAccountPage(accounts []*account.Account, next string) *AccountPage {
+	page := &AccountPage{Accounts: []*Account{}}
+	for _, a := range accounts {
+		page.Accounts = append(page.Accounts, toAccount(a))
+	}
+	if next != "" {
+		page.NextCursor = &next
+	}
+	return page
+}
+
+func toAccountFilter(in *AccountFilterInput) account.AccountFilter {
+	f := account.AccountFilter{}
+	if in == nil {
+		return f
+	}
+
+	if in.Query != nil {
+		f.Query = *in.Query
+	}
+	if in.CreatedAfter != nil {
+		f.CreatedAfter = *in.CreatedAfter
+	}
+	if in.CreatedBefore != nil {
+		f.CreatedBefore = *in.CreatedBefore
+	}
+	return f
+}
+
+func toOrderPage(orders []*order.Order, next string) *OrderPage {
+	page := &OrderPage{Orders: []*Order{}}
+	for _, o := range orders {
+		page.Orders = append(page.Orders, toOrder(o))
+	}
+	if next != "" {
+		page.NextCursor = &next
+	}
+	return page
+}
+
+func toOrderFilter(in *OrderFilterInput) (order.OrderFilter, error) {
+	f := order.OrderFilter{}
+	if in == nil {
+		return f, nil
+	}
+
+	if in.AccountID != nil {
+		f.AccountID = *in.AccountID
+	}
+	if in.ProductID != nil {
+		f.ProductID = *in.ProductID
+	}
+	if in.CreatedAfter != nil {
+		f.CreatedAfter = *in.CreatedAfter
+	}
+	if in.CreatedBefore != nil {
+		f.CreatedBefore = *in.CreatedBefore
+	}
+	if in.MinTotal != nil {
+		m, err := parseMoney(in.MinTotal)
+		if err != nil {
+			return f, err
+		}
+		f.MinTotal = &m
+	}
+	if in.MaxTotal != nil {
+		m, err := parseMoney(in.MaxTotal)
+		if err != nil {
+			return f, err
+		}
+		f.MaxTotal = &m
+	}
+	if in.Sort != nil {
+		if !in.Sort.IsValid() {
+			return f, ErrInvalidParameter
+		}
+		f.Sort = order.Sort(strings.ToLower(in.Sort.String()))
+	}
+
+	return f, nil
+}
+
+func toProductFilter(category *string, minPrice *MoneyInput, maxPrice *MoneyInput, sort *ProductSort) (catalog.ProductFilter, error) {
+	f := catalog.ProductFilter{}
+	if category != nil {
+		f.CategoryID = *category
+	}
+	if minPrice != nil {
+		m, err := parseMoney(minPrice)
+		if err != nil {
+			return f, err
+		}
+		f.MinPrice = &m
+	}
+	if maxPrice != nil {
+		m, err := parseMoney(maxPrice)
+		if err != nil {
+			return f, err
+		}
+		f.MaxPrice = &m
+	}
+	if sort != nil {
+		if !sort.IsValid() {
+			return f, ErrInvalidParameter
+		}
+		f.Sort = catalog.Sort(strings.ToLower(sort.String()))
+	}
+
+	return f, nil
+}
+
+func parseMoney(in *MoneyInput) (money.Money, error) {
+	currency := ""
+	if in.Currency != nil {
+		currency = *in.Currency
+	}
+	m, err := money.Parse(in.Amount, currency)
+	if err != nil {
+		return money.Money{}, ErrInvalidParameter
+	}
+	return m, nil
+}
+
+func toCart(c *cart.Cart) *Cart {
+	items := []*CartItem{}
+	for _, i := range c.Items {
+		item := &CartItem{
+			ProductID: i.ProductID,
+			Name:      i.Name,
+			Price:     toMoney(i.Price),
+			Quantity:  int(i.Quantity),
+		}
+		if i.SKU != "" {
+			item.Sku = &i.SKU
+		}
+		items = append(items, item)
+	}
+
+	gc := &Cart{
+		AccountID: c.AccountID,
+		Items:     items,
+	}
+	if total, err := c.TotalPrice(); err == nil {
+		gc.TotalPrice = toMoney(total)
+	}
+	return gc
 }
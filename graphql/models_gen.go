@@ -3,39 +3,172 @@
 package main
 
 import (
+	"fmt"
+	"io"
+	"strconv"
 	"time"
 )
 
+type AccountFilterInput struct {
+	Query         *string    `json:"query,omitempty"`
+	CreatedAfter  *time.Time `json:"createdAfter,omitempty"`
+	CreatedBefore *time.Time `json:"createdBefore,omitempty"`
+}
+
 type AccountInput struct {
 	Name string `json:"name"`
 }
 
+type AccountPage struct {
+	Accounts   []*Account `json:"accounts"`
+	NextCursor *string    `json:"nextCursor,omitempty"`
+}
+
+type AccountUpdateInput struct {
+	Name        *string `json:"name,omitempty"`
+	DisplayName *string `json:"displayName,omitempty"`
+	Email       *string `json:"email,omitempty"`
+	Phone       *string `json:"phone,omitempty"`
+}
+
+type Address struct {
+	ID              string `json:"id"`
+	Label           string `json:"label"`
+	Recipient       string `json:"recipient"`
+	Line1           string `json:"line1"`
+	Line2           string `json:"line2"`
+	City            string `json:"city"`
+	PostalCode      string `json:"postalCode"`
+	Country         string `json:"country"`
+	DefaultShipping bool   `json:"defaultShipping"`
+	DefaultBilling  bool   `json:"defaultBilling"`
+}
+
+type AddressInput struct {
+	Label           *string `json:"label,omitempty"`
+	Recipient       string  `json:"recipient"`
+	Line1           string  `json:"line1"`
+	Line2           *string `json:"line2,omitempty"`
+	City            string  `json:"city"`
+	PostalCode      *string `json:"postalCode,omitempty"`
+	Country         string  `json:"country"`
+	DefaultShipping *bool   `json:"defaultShipping,omitempty"`
+	DefaultBilling  *bool   `json:"defaultBilling,omitempty"`
+}
+
+type Attribute struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type AttributeInput struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type AuthPayload struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Account   *Account  `json:"account"`
+}
+
+type Cart struct {
+	AccountID  string      `json:"accountId"`
+	Items      []*CartItem `json:"items"`
+	TotalPrice *Money      `json:"totalPrice,omitempty"`
+}
+
+type CartItem struct {
+	ProductID string  `json:"productId"`
+	Sku       *string `json:"sku,omitempty"`
+	Name      string  `json:"name"`
+	Price     *Money  `json:"price"`
+	Quantity  int     `json:"quantity"`
+}
+
+type CartItemInput struct {
+	AccountID string  `json:"accountId"`
+	ProductID string  `json:"productId"`
+	Sku       *string `json:"sku,omitempty"`
+	Quantity  int     `json:"quantity"`
+}
+
+type Category struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	ParentID *string  `json:"parentId,omitempty"`
+	Path     []string `json:"path"`
+}
+
+type CursorInput struct {
+	After *string `json:"after,omitempty"`
+	Take  *int    `json:"take,omitempty"`
+}
+
+type Money struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+type MoneyInput struct {
+	Amount   string  `json:"amount"`
+	Currency *string `json:"currency,omitempty"`
+}
+
 type Mutation struct {
 }
 
 type Order struct {
-	ID         string            `json:"id"`
-	CreatedAt  time.Time         `json:"createdAt"`
-	TotalPrice float64           `json:"totalPrice"`
-	Products   []*OrderedProduct `json:"products"`
+	ID              string               `json:"id"`
+	CreatedAt       time.Time            `json:"createdAt"`
+	TotalPrice      *Money               `json:"totalPrice"`
+	Status          OrderStatus          `json:"status"`
+	StatusHistory   []*OrderStatusChange `json:"statusHistory"`
+	Products        []*OrderedProduct    `json:"products"`
+	ShippingAddress *ShippingAddress     `json:"shippingAddress,omitempty"`
+}
+
+type OrderFilterInput struct {
+	AccountID     *string     `json:"accountId,omitempty"`
+	ProductID     *string     `json:"productId,omitempty"`
+	CreatedAfter  *time.Time  `json:"createdAfter,omitempty"`
+	CreatedBefore *time.Time  `json:"createdBefore,omitempty"`
+	MinTotal      *MoneyInput `json:"minTotal,omitempty"`
+	MaxTotal      *MoneyInput `json:"maxTotal,omitempty"`
+	Sort          *OrderSort  `json:"sort,omitempty"`
 }
 
 type OrderInput struct {
-	AccountID string               `json:"accountId"`
-	Products  []*OrderProductInput `json:"products"`
+	AccountID         string               `json:"accountId"`
+	Products          []*OrderProductInput `json:"products"`
+	ShippingAddressID *string              `json:"shippingAddressId,omitempty"`
+	IdempotencyKey    *string              `json:"idempotencyKey,omitempty"`
+}
+
+type OrderPage struct {
+	Orders     []*Order `json:"orders"`
+	NextCursor *string  `json:"nextCursor,omitempty"`
 }
 
 type OrderProductInput struct {
-	ID       string `json:"id"`
-	Quantity int    `json:"quantity"`
+	ID       string  `json:"id"`
+	Sku      *string `json:"sku,omitempty"`
+	Quantity int     `json:"quantity"`
+}
+
+type OrderStatusChange struct {
+	Status    OrderStatus `json:"status"`
+	CreatedAt time.Time   `json:"createdAt"`
 }
 
 type OrderedProduct struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	Quantity    int     `json:"quantity"`
+	ID          string       `json:"id"`
+	Sku         *string      `json:"sku,omitempty"`
+	Attributes  []*Attribute `json:"attributes"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Price       *Money       `json:"price,omitempty"`
+	Quantity    int          `json:"quantity"`
 }
 
 type PaginationInput struct {
@@ -43,18 +176,272 @@ type PaginationInput struct {
 	Take *int `json:"take,omitempty"`
 }
 
+type PriceBucket struct {
+	From  *Money `json:"from"`
+	To    *Money `json:"to"`
+	Count int    `json:"count"`
+}
+
 type Product struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
+	ID                string     `json:"id"`
+	Name              string     `json:"name"`
+	Description       string     `json:"description"`
+	Price             *Money     `json:"price"`
+	Version           int        `json:"version"`
+	AvailableQuantity int        `json:"availableQuantity"`
+	CategoryIds       []string   `json:"categoryIds"`
+	Variants          []*Variant `json:"variants"`
+}
+
+type ProductFacets struct {
+	Price []*PriceBucket `json:"price"`
+	Terms []*TermFacet   `json:"terms"`
 }
 
 type ProductInput struct {
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Price       *MoneyInput     `json:"price"`
+	CategoryIds []string        `json:"categoryIds,omitempty"`
+	Variants    []*VariantInput `json:"variants,omitempty"`
+}
+
+type ProductSearchResult struct {
+	Items  []*Product     `json:"items"`
+	Facets *ProductFacets `json:"facets"`
+	Total  int            `json:"total"`
+}
+
+type ProductSuggestion struct {
+	ProductID string `json:"productId"`
+	Name      string `json:"name"`
+}
+
+type ProductUpdateInput struct {
+	Name        *string         `json:"name,omitempty"`
+	Description *string         `json:"description,omitempty"`
+	Price       *MoneyInput     `json:"price,omitempty"`
+	CategoryIds []string        `json:"categoryIds,omitempty"`
+	Variants    []*VariantInput `json:"variants,omitempty"`
 }
 
 type Query struct {
 }
+
+type RegisterInput struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type ShippingAddress struct {
+	AddressID  string `json:"addressId"`
+	Recipient  string `json:"recipient"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2"`
+	City       string `json:"city"`
+	PostalCode string `json:"postalCode"`
+	Country    string `json:"country"`
+}
+
+type TermBucket struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type TermFacet struct {
+	Field   string        `json:"field"`
+	Buckets []*TermBucket `json:"buckets"`
+}
+
+type Variant struct {
+	Sku        string       `json:"sku"`
+	Attributes []*Attribute `json:"attributes"`
+	Price      *Money       `json:"price"`
+	Active     bool         `json:"active"`
+}
+
+type VariantInput struct {
+	Sku        string            `json:"sku"`
+	Attributes []*AttributeInput `json:"attributes,omitempty"`
+	Price      *MoneyInput       `json:"price,omitempty"`
+	Active     *bool             `json:"active,omitempty"`
+}
+
+type OrderSort string
+
+const (
+	OrderSortNewestFirst OrderSort = "NEWEST_FIRST"
+	OrderSortOldestFirst OrderSort = "OLDEST_FIRST"
+)
+
+var AllOrderSort = []OrderSort{
+	OrderSortNewestFirst,
+	OrderSortOldestFirst,
+}
+
+func (e OrderSort) IsValid() bool {
+	switch e {
+	case OrderSortNewestFirst, OrderSortOldestFirst:
+		return true
+	}
+	return false
+}
+
+func (e OrderSort) String() string {
+	return string(e)
+}
+
+func (e *OrderSort) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OrderSort(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OrderSort", str)
+	}
+	return nil
+}
+
+func (e OrderSort) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type OrderStatus string
+
+const (
+	OrderStatusPending   OrderStatus = "PENDING"
+	OrderStatusPaid      OrderStatus = "PAID"
+	OrderStatusFulfilled OrderStatus = "FULFILLED"
+	OrderStatusShipped   OrderStatus = "SHIPPED"
+	OrderStatusDelivered OrderStatus = "DELIVERED"
+	OrderStatusCancelled OrderStatus = "CANCELLED"
+)
+
+var AllOrderStatus = []OrderStatus{
+	OrderStatusPending,
+	OrderStatusPaid,
+	OrderStatusFulfilled,
+	OrderStatusShipped,
+	OrderStatusDelivered,
+	OrderStatusCancelled,
+}
+
+func (e OrderStatus) IsValid() bool {
+	switch e {
+	case OrderStatusPending, OrderStatusPaid, OrderStatusFulfilled, OrderStatusShipped, OrderStatusDelivered, OrderStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func (e OrderStatus) String() string {
+	return string(e)
+}
+
+func (e *OrderStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OrderStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OrderStatus", str)
+	}
+	return nil
+}
+
+func (e OrderStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ProductSort string
+
+const (
+	ProductSortRelevance ProductSort = "RELEVANCE"
+	ProductSortPriceAsc  ProductSort = "PRICE_ASC"
+	ProductSortPriceDesc ProductSort = "PRICE_DESC"
+	ProductSortNewest    ProductSort = "NEWEST"
+)
+
+var AllProductSort = []ProductSort{
+	ProductSortRelevance,
+	ProductSortPriceAsc,
+	ProductSortPriceDesc,
+	ProductSortNewest,
+}
+
+func (e ProductSort) IsValid() bool {
+	switch e {
+	case ProductSortRelevance, ProductSortPriceAsc, ProductSortPriceDesc, ProductSortNewest:
+		return true
+	}
+	return false
+}
+
+func (e ProductSort) String() string {
+	return string(e)
+}
+
+func (e *ProductSort) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ProductSort(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ProductSort", str)
+	}
+	return nil
+}
+
+func (e ProductSort) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type Role string
+
+const (
+	RoleCustomer Role = "CUSTOMER"
+	RoleStaff    Role = "STAFF"
+	RoleAdmin    Role = "ADMIN"
+)
+
+var AllRole = []Role{
+	RoleCustomer,
+	RoleStaff,
+	RoleAdmin,
+}
+
+func (e Role) IsValid() bool {
+	switch e {
+	case RoleCustomer, RoleStaff, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+func (e Role) String() string {
+	return string(e)
+}
+
+func (e *Role) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Role(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Role", str)
+	}
+	return nil
+}
+
+func (e Role) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
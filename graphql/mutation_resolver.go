@@ -3,8 +3,11 @@ package main
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
+	"github.com/jaykapade/cart-microservice/account"
+	"github.com/jaykapade/cart-microservice/catalog"
 	"github.com/jaykapade/cart-microservice/order"
 )
 
@@ -22,12 +25,130 @@ func (r *mutationResolver) CreateAccount(ctx context.Context, in AccountInput) (
 
 	a, err := r.server.accountClient.PostAccount(ctx, in.Name)
 	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return toAccount(a), nil
+}
+
+func (r *mutationResolver) UpdateAccount(ctx context.Context, id string, in AccountUpdateInput) (*Account, error) {
+	if err := authorizeAccount(ctx, id); err != nil {
 		return nil, err
 	}
 
-	return &Account{
-		ID:   a.ID,
-		Name: a.Name,
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	a, err := r.server.accountClient.UpdateAccount(ctx, id, account.AccountUpdate{
+		Name:        in.Name,
+		DisplayName: in.DisplayName,
+		Email:       in.Email,
+		Phone:       in.Phone,
+	})
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return toAccount(a), nil
+}
+
+func (r *mutationResolver) DeleteAccount(ctx context.Context, id string) (bool, error) {
+	if err := authorizeAccount(ctx, id); err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if err := r.server.accountClient.DeleteAccount(ctx, id); err != nil {
+		return false, grpcError(ctx, err)
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) CreateAddress(ctx context.Context, accountID string, in AddressInput) (*Address, error) {
+	if err := authorizeAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	a, err := r.server.accountClient.CreateAddress(ctx, accountID, toAccountAddress("", in))
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return toAddress(a), nil
+}
+
+func (r *mutationResolver) UpdateAddress(ctx context.Context, id string, in AddressInput) (*Address, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if err := r.authorizeAddress(ctx, id); err != nil {
+		return nil, err
+	}
+
+	a, err := r.server.accountClient.UpdateAddress(ctx, toAccountAddress(id, in))
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return toAddress(a), nil
+}
+
+func (r *mutationResolver) DeleteAddress(ctx context.Context, id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if err := r.authorizeAddress(ctx, id); err != nil {
+		return false, err
+	}
+
+	if err := r.server.accountClient.DeleteAddress(ctx, id); err != nil {
+		return false, grpcError(ctx, err)
+	}
+
+	return true, nil
+}
+
+// authorizeAddress checks that the caller may change the address with id,
+// i.e. that it belongs to an account they may act on.
+func (r *mutationResolver) authorizeAddress(ctx context.Context, id string) error {
+	a, err := r.server.accountClient.GetAddress(ctx, id)
+	if err != nil {
+		return grpcError(ctx, err)
+	}
+	return authorizeAccount(ctx, a.AccountID)
+}
+
+func (r *mutationResolver) Register(ctx context.Context, in RegisterInput) (*Account, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	a, err := r.server.accountClient.Register(ctx, in.Name, in.Email, in.Password)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return toAccount(a), nil
+}
+
+func (r *mutationResolver) Login(ctx context.Context, email string, password string) (*AuthPayload, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	t, err := r.server.accountClient.Login(ctx, email, password)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return &AuthPayload{
+		Token:     t.Token,
+		ExpiresAt: t.ExpiresAt,
+		Account:   toAccount(t.Account),
 	}, nil
 }
 
@@ -35,20 +156,145 @@ func (r *mutationResolver) CreateProduct(ctx context.Context, in ProductInput) (
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	p, err := r.server.catalogClient.PostProduct(ctx, in.Name, in.Description, in.Price)
+	price, err := parseMoney(in.Price)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Product{
-		ID:          p.ID,
-		Name:        p.Name,
-		Description: p.Description,
-		Price:       p.Price,
-	}, nil
+	variants, err := toCatalogVariants(in.Variants)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := r.server.catalogClient.PostProduct(ctx, in.Name, in.Description, price, in.CategoryIds, variants)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return toProduct(p), nil
+}
+
+func (r *mutationResolver) UpdateProduct(ctx context.Context, id string, in ProductUpdateInput, version *int) (*Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	update := catalog.ProductUpdate{
+		Name:        in.Name,
+		Description: in.Description,
+	}
+	if in.CategoryIds != nil {
+		update.CategoryIDs = &in.CategoryIds
+	}
+	if in.Price != nil {
+		price, err := parseMoney(in.Price)
+		if err != nil {
+			return nil, err
+		}
+		update.Price = &price
+	}
+	if in.Variants != nil {
+		variants, err := toCatalogVariants(in.Variants)
+		if err != nil {
+			return nil, err
+		}
+		update.Variants = &variants
+	}
+
+	v := int64(0)
+	if version != nil {
+		v = int64(*version)
+	}
+
+	p, err := r.server.catalogClient.UpdateProduct(ctx, id, update, v)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return toProduct(p), nil
+}
+
+func (r *mutationResolver) DeleteProduct(ctx context.Context, id string, version *int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	v := int64(0)
+	if version != nil {
+		v = int64(*version)
+	}
+
+	if err := r.server.catalogClient.DeleteProduct(ctx, id, v); err != nil {
+		return false, grpcError(ctx, err)
+	}
+
+	return true, nil
+}
+
+func (r *mutationResolver) AdjustStock(ctx context.Context, productID string, delta int) (*Product, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if _, err := r.server.catalogClient.AdjustStock(ctx, productID, int64(delta)); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	p, err := r.server.catalogClient.GetProduct(ctx, productID)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return toProduct(p), nil
+}
+
+func (r *mutationResolver) CreateCategory(ctx context.Context, name string, parentID *string) (*Category, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	parent := ""
+	if parentID != nil {
+		parent = *parentID
+	}
+
+	c, err := r.server.catalogClient.CreateCategory(ctx, name, parent)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return toCategory(c), nil
+}
+
+func (r *mutationResolver) MoveCategory(ctx context.Context, id string, parentID *string) (*Category, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	parent := ""
+	if parentID != nil {
+		parent = *parentID
+	}
+
+	c, err := r.server.catalogClient.MoveCategory(ctx, id, parent)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return toCategory(c), nil
+}
+
+func (r *mutationResolver) DeleteCategory(ctx context.Context, id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if err := r.server.catalogClient.DeleteCategory(ctx, id); err != nil {
+		return false, grpcError(ctx, err)
+	}
+
+	return true, nil
 }
 
 func (r *mutationResolver) CreateOrder(ctx context.Context, in OrderInput) (*Order, error) {
+	if err := authorizeAccount(ctx, in.AccountID); err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
@@ -58,31 +304,160 @@ func (r *mutationResolver) CreateOrder(ctx context.Context, in OrderInput) (*Ord
 			return nil, ErrInvalidParameter
 		}
 
-		products = append(products, &order.OrderedProduct{
+		product := &order.OrderedProduct{
 			ID:       p.ID,
 			Quantity: uint32(p.Quantity),
-		})
+		}
+		if p.Sku != nil {
+			product.SKU = *p.Sku
+		}
+		products = append(products, product)
+	}
+
+	idempotencyKey := ""
+	if in.IdempotencyKey != nil {
+		idempotencyKey = *in.IdempotencyKey
+	}
+
+	shippingAddressID := ""
+	if in.ShippingAddressID != nil {
+		shippingAddressID = *in.ShippingAddressID
+	}
+
+	o, err := r.server.orderClient.PostOrder(ctx, in.AccountID, shippingAddressID, products, idempotencyKey)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return toOrder(o), nil
+}
+
+func (r *mutationResolver) UpdateOrderStatus(ctx context.Context, id string, status OrderStatus) (*Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if !status.IsValid() {
+		return nil, ErrInvalidParameter
 	}
 
-	o, err := r.server.orderClient.PostOrder(ctx, in.AccountID, products)
+	o, err := r.server.orderClient.UpdateOrderStatus(ctx, id, order.Status(strings.ToLower(status.String())))
 	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return toOrder(o), nil
+}
+
+func (r *mutationResolver) AddToCart(ctx context.Context, in CartItemInput) (*Cart, error) {
+	if err := authorizeAccount(ctx, in.AccountID); err != nil {
 		return nil, err
 	}
 
-	var orderedProducts []*OrderedProduct
-	for _, p := range o.Products {
-		orderedProducts = append(orderedProducts, &OrderedProduct{
-			ID:       p.ID,
-			Name:     p.Name,
-			Price:    p.Price,
-			Quantity: int(p.Quantity),
-		})
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if in.Quantity < 1 {
+		return nil, ErrInvalidParameter
 	}
 
-	return &Order{
-		ID:         o.ID,
-		CreatedAt:  o.CreatedAt,
-		Products:   orderedProducts,
-		TotalPrice: o.TotalPrice,
-	}, nil
+	sku := ""
+	if in.Sku != nil {
+		sku = *in.Sku
+	}
+
+	c, err := r.server.cartClient.AddItem(ctx, in.AccountID, in.ProductID, sku, uint32(in.Quantity))
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return toCart(c), nil
+}
+
+func (r *mutationResolver) UpdateCartItem(ctx context.Context, in CartItemInput) (*Cart, error) {
+	if err := authorizeAccount(ctx, in.AccountID); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if in.Quantity < 0 {
+		return nil, ErrInvalidParameter
+	}
+
+	sku := ""
+	if in.Sku != nil {
+		sku = *in.Sku
+	}
+
+	c, err := r.server.cartClient.UpdateItem(ctx, in.AccountID, in.ProductID, sku, uint32(in.Quantity))
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return toCart(c), nil
+}
+
+func (r *mutationResolver) RemoveFromCart(ctx context.Context, accountID string, productID string, sku *string) (*Cart, error) {
+	if err := authorizeAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	s := ""
+	if sku != nil {
+		s = *sku
+	}
+
+	c, err := r.server.cartClient.RemoveItem(ctx, accountID, productID, s)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return toCart(c), nil
+}
+
+func (r *mutationResolver) Checkout(ctx context.Context, accountID string, shippingAddressID *string, idempotencyKey *string) (*Order, error) {
+	if err := authorizeAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	key := ""
+	if idempotencyKey != nil {
+		key = *idempotencyKey
+	}
+
+	addressID := ""
+	if shippingAddressID != nil {
+		addressID = *shippingAddressID
+	}
+
+	orderID, err := r.server.cartClient.Checkout(ctx, accountID, addressID, key)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	o, err := r.server.orderClient.GetOrder(ctx, orderID)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return toOrder(o), nil
+}
+
+func (r *mutationResolver) SetAccountRole(ctx context.Context, id string, role Role) (*Account, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	a, err := r.server.accountClient.SetAccountRole(ctx, id, toAccountRole(role))
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return toAccount(a), nil
 }
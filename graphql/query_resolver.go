@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"time"
 )
 
@@ -9,60 +10,103 @@ type queryResolver struct {
 	server *Server
 }
 
-func (r *queryResolver) Accounts(ctx context.Context, pagination *PaginationInput, id *string) ([]*Account, error) {
+// Me returns the account of the bearer token the request was sent with, or
+// null for anonymous requests.
+func (r *queryResolver) Me(ctx context.Context) (*Account, error) {
+	v := viewerFrom(ctx)
+	if v == nil {
+		return nil, nil
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	if id != nil {
-		r, err := r.server.accountClient.GetAccount(ctx, *id)
-		if err != nil {
-			return nil, err
-		}
-
-		return []*Account{{
-			ID:   r.ID,
-			Name: r.Name,
-		}}, nil
+	a, err := r.server.accountClient.GetAccount(ctx, v.AccountID)
+	if err != nil {
+		return nil, grpcError(ctx, err)
 	}
 
-	skip, take := uint64(0), uint64(0)
-	if pagination != nil {
-		skip, take = pagination.bounds()
+	return toAccount(a), nil
+}
+
+// ExportAccountData returns the account's data as a JSON document. It pages
+// through every order of the account, so it gets a longer timeout.
+func (r *queryResolver) ExportAccountData(ctx context.Context, id string) (string, error) {
+	if err := authorizeAccount(ctx, id); err != nil {
+		return "", err
 	}
 
-	accountList, err := r.server.accountClient.GetAccounts(ctx, skip, take)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	archive, err := r.server.accountClient.ExportAccountData(ctx, id)
 	if err != nil {
+		return "", grpcError(ctx, err)
+	}
+
+	return string(archive), nil
+}
+
+func (r *queryResolver) Account(ctx context.Context, id string) (*Account, error) {
+	if err := authorizeAccount(ctx, id); err != nil {
 		return nil, err
 	}
 
-	var accounts []*Account
-	for _, a := range accountList {
-		accounts = append(accounts, &Account{
-			ID:   a.ID,
-			Name: a.Name,
-		})
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	a, err := r.server.accountClient.GetAccount(ctx, id)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return toAccount(a), nil
+}
+
+func (r *queryResolver) Accounts(ctx context.Context, filter *AccountFilterInput, after *string, first *int) (*AccountPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	// Customers only see their own account, so there is nothing for them to
+	// filter or page through.
+	if !isStaff(ctx) {
+		if filter != nil || after != nil || first != nil {
+			return nil, errForbidden(ctx)
+		}
+		a, err := r.server.accountClient.GetAccount(ctx, viewerFrom(ctx).AccountID)
+		if err != nil {
+			return nil, grpcError(ctx, err)
+		}
+		return &AccountPage{Accounts: []*Account{toAccount(a)}}, nil
 	}
 
-	return accounts, nil
+	cursor, take := "", uint64(0)
+	if after != nil {
+		cursor = *after
+	}
+	if first != nil && *first > 0 {
+		take = uint64(*first)
+	}
+
+	accountList, next, err := r.server.accountClient.SearchAccounts(ctx, toAccountFilter(filter), cursor, take)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
 
+	return toAccountPage(accountList, next), nil
 }
 
-func (r *queryResolver) Products(ctx context.Context, pagination *PaginationInput, query *string, id *string) ([]*Product, error) {
+func (r *queryResolver) Products(ctx context.Context, pagination *PaginationInput, query *string, id *string, category *string, minPrice *MoneyInput, maxPrice *MoneyInput, sort *ProductSort) ([]*Product, error) {
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	if id != nil {
 		pdt, err := r.server.catalogClient.GetProduct(ctx, *id)
 		if err != nil {
-			return nil, err
+			return nil, grpcError(ctx, err)
 		}
 
-		return []*Product{{
-			ID:          pdt.ID,
-			Name:        pdt.Name,
-			Description: pdt.Description,
-			Price:       pdt.Price,
-		}}, nil
+		return []*Product{toProduct(pdt)}, nil
 	}
 
 	skip, take := uint64(0), uint64(0)
@@ -75,24 +119,166 @@ func (r *queryResolver) Products(ctx context.Context, pagination *PaginationInpu
 		q = *query
 	}
 
-	productList, err := r.server.catalogClient.GetProducts(ctx, skip, take, nil, q)
+	filter, err := toProductFilter(category, minPrice, maxPrice, sort)
 	if err != nil {
 		return nil, err
 	}
+
+	productList, err := r.server.catalogClient.GetProducts(ctx, skip, take, nil, q, filter)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
 	var products []*Product
 
 	for _, p := range productList {
-		product := &Product{
-			ID:          p.ID,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
+		products = append(products, toProduct(p))
+	}
+
+	return products, nil
+}
+
+func (r *queryResolver) SearchProducts(ctx context.Context, query string, pagination *PaginationInput, category *string, minPrice *MoneyInput, maxPrice *MoneyInput, sort *ProductSort) (*ProductSearchResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	skip, take := uint64(0), uint64(0)
+	if pagination != nil {
+		skip, take = pagination.bounds()
+	}
+
+	filter, err := toProductFilter(category, minPrice, maxPrice, sort)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := r.server.catalogClient.SearchProducts(ctx, query, filter, skip, take)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return toProductSearchResult(result), nil
+}
+
+// suggestTimeout keeps autocomplete snappy; a slow suggestion is worse than
+// none, as the next keystroke replaces it anyway.
+const suggestTimeout = 300 * time.Millisecond
+
+func (r *queryResolver) ProductSuggestions(ctx context.Context, prefix string, size *int) ([]*ProductSuggestion, error) {
+	ctx, cancel := context.WithTimeout(ctx, suggestTimeout)
+	defer cancel()
+
+	n := uint32(0)
+	if size != nil {
+		if *size < 0 {
+			return nil, ErrInvalidParameter
 		}
+		n = uint32(*size)
+	}
 
-		products = append(products, product)
+	suggestionList, err := r.server.catalogClient.SuggestProducts(ctx, prefix, n)
+	if err != nil {
+		return nil, grpcError(ctx, err)
 	}
 
-	return products, nil
+	suggestions := []*ProductSuggestion{}
+	for _, s := range suggestionList {
+		suggestions = append(suggestions, &ProductSuggestion{
+			ProductID: s.ProductID,
+			Name:      s.Name,
+		})
+	}
+
+	return suggestions, nil
+}
+
+// Categories returns the whole category tree, or only the direct children of
+// parentId when it is given.
+func (r *queryResolver) Categories(ctx context.Context, parentID *string) ([]*Category, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	categoryList, err := r.server.catalogClient.GetCategories(ctx)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	categories := []*Category{}
+	for _, c := range categoryList {
+		if parentID != nil && c.ParentID != *parentID {
+			continue
+		}
+		categories = append(categories, toCategory(c))
+	}
+
+	return categories, nil
+}
+
+func (r *queryResolver) Order(ctx context.Context, id string) (*Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if viewerFrom(ctx) == nil {
+		return nil, errUnauthenticated(ctx)
+	}
+
+	o, err := r.server.orderClient.GetOrder(ctx, id)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	// Other accounts' orders look missing, so that IDs cannot be probed.
+	if err := authorizeAccount(ctx, o.AccountID); err != nil {
+		return nil, gqlError(ctx, "NOT_FOUND", fmt.Sprintf("order %s not found", id))
+	}
+
+	return toOrder(o), nil
+}
+
+func (r *queryResolver) Orders(ctx context.Context, filter *OrderFilterInput, pagination *CursorInput) (*OrderPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	f, err := toOrderFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Customers only see their own orders.
+	if !isStaff(ctx) {
+		if f.AccountID == "" {
+			f.AccountID = viewerFrom(ctx).AccountID
+		}
+		if err := authorizeAccount(ctx, f.AccountID); err != nil {
+			return nil, err
+		}
+	}
+
+	after, take := "", uint64(0)
+	if pagination != nil {
+		after, take = pagination.bounds()
+	}
+
+	orderList, next, err := r.server.orderClient.ListOrders(ctx, f, after, take)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return toOrderPage(orderList, next), nil
+}
+
+func (r *queryResolver) Cart(ctx context.Context, accountID string) (*Cart, error) {
+	if err := authorizeAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	c, err := r.server.cartClient.GetCart(ctx, accountID)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+
+	return toCart(c), nil
 }
 
 func (p PaginationInput) bounds() (uint64, uint64) {
@@ -108,3 +294,17 @@ func (p PaginationInput) bounds() (uint64, uint64) {
 
 	return skipValue, takeValue
 }
+
+func (p CursorInput) bounds() (string, uint64) {
+	after := ""
+	takeValue := uint64(0)
+
+	if p.After != nil {
+		after = *p.After
+	}
+	if p.Take != nil {
+		takeValue = uint64(*p.Take)
+	}
+
+	return after, takeValue
+}
@@ -0,0 +1,176 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var (
+	ErrInvalidAmount    = errors.New("invalid money amount")
+	ErrInvalidCurrency  = errors.New("invalid currency")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrOverflow         = errors.New("money amount overflow")
+)
+
+const DefaultCurrency = "USD"
+
+// exponents holds the number of minor-unit digits for currencies that do not
+// use the ISO 4217 default of two.
+var exponents = map[string]int{
+	"BHD": 3,
+	"CLP": 0,
+	"ISK": 0,
+	"JOD": 3,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"OMR": 3,
+	"TND": 3,
+	"VND": 0,
+}
+
+// Money is an exact amount in the minor unit of an ISO 4217 currency, e.g.
+// cents for USD.
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+func Zero(currency string) Money {
+	return New(0, currency)
+}
+
+// Parse reads a decimal string such as "12.345" in the given currency,
+// rounding digits beyond the currency's minor unit half to even.
+func Parse(amount string, currency string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	if !ValidCurrency(currency) {
+		return Money{}, ErrInvalidCurrency
+	}
+
+	s := strings.TrimSpace(amount)
+	negative := false
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return Money{}, ErrInvalidAmount
+	}
+	for _, c := range whole + frac {
+		if c < '0' || c > '9' {
+			return Money{}, ErrInvalidAmount
+		}
+	}
+
+	exp := Exponent(currency)
+	rest := ""
+	if len(frac) > exp {
+		frac, rest = frac[:exp], frac[exp:]
+	}
+	frac += strings.Repeat("0", exp-len(frac))
+
+	var minor int64
+	for _, c := range whole + frac {
+		digit := int64(c - '0')
+		if minor > (math.MaxInt64-digit)/10 {
+			return Money{}, ErrOverflow
+		}
+		minor = minor*10 + digit
+	}
+
+	if roundUp(minor, rest) {
+		if minor == math.MaxInt64 {
+			return Money{}, ErrOverflow
+		}
+		minor++
+	}
+	if negative {
+		minor = -minor
+	}
+
+	return Money{Amount: minor, Currency: currency}, nil
+}
+
+// roundUp reports whether the discarded digits rest push minor to the next
+// unit under round-half-to-even.
+func roundUp(minor int64, rest string) bool {
+	if rest == "" || rest[0] < '5' {
+		return false
+	}
+	if rest[0] > '5' || strings.Trim(rest[1:], "0") != "" {
+		return true
+	}
+	return minor%2 == 1
+}
+
+func ValidCurrency(currency string) bool {
+	if len(currency) != 3 {
+		return false
+	}
+	for _, c := range currency {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Exponent returns the number of minor-unit digits of the currency.
+func Exponent(currency string) int {
+	if exp, ok := exponents[currency]; ok {
+		return exp
+	}
+	return 2
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	sum := m.Amount + o.Amount
+	if (o.Amount > 0 && sum < m.Amount) || (o.Amount < 0 && sum > m.Amount) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+// Mul returns the line total for quantity units priced at m. Amounts are
+// already in minor units, so the product is exact.
+func (m Money) Mul(quantity uint32) (Money, error) {
+	if quantity != 0 && (m.Amount > math.MaxInt64/int64(quantity) || m.Amount < math.MinInt64/int64(quantity)) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: m.Amount * int64(quantity), Currency: m.Currency}, nil
+}
+
+// String formats the amount as a plain decimal without the currency code,
+// e.g. "12.30".
+func (m Money) String() string {
+	exp := Exponent(m.Currency)
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+	}
+	digits := fmt.Sprintf("%d", amount)
+	digits = strings.TrimPrefix(digits, "-")
+	if exp == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+}
@@ -0,0 +1,126 @@
+package money
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		want     Money
+		err      error
+	}{
+		{"12.30", "usd", Money{1230, "USD"}, nil},
+		{"12.3", "", Money{1230, "USD"}, nil},
+		{"12", "EUR", Money{1200, "EUR"}, nil},
+		{".5", "EUR", Money{50, "EUR"}, nil},
+		{" -1.25 ", "EUR", Money{-125, "EUR"}, nil},
+		{"+1.25", "EUR", Money{125, "EUR"}, nil},
+		{"1500", "JPY", Money{1500, "JPY"}, nil},
+		{"1.2345", "KWD", Money{1234, "KWD"}, nil},
+
+		// Digits beyond the minor unit round half to even.
+		{"0.125", "USD", Money{12, "USD"}, nil},
+		{"0.135", "USD", Money{14, "USD"}, nil},
+		{"0.1250", "USD", Money{12, "USD"}, nil},
+		{"0.1251", "USD", Money{13, "USD"}, nil},
+		{"0.124999", "USD", Money{12, "USD"}, nil},
+		{"0.126", "USD", Money{13, "USD"}, nil},
+		{"-0.125", "USD", Money{-12, "USD"}, nil},
+		{"-0.135", "USD", Money{-14, "USD"}, nil},
+		{"2.5", "JPY", Money{2, "JPY"}, nil},
+		{"3.5", "JPY", Money{4, "JPY"}, nil},
+		{"0.995", "USD", Money{100, "USD"}, nil},
+
+		{"", "USD", Money{}, ErrInvalidAmount},
+		{".", "USD", Money{}, ErrInvalidAmount},
+		{"-", "USD", Money{}, ErrInvalidAmount},
+		{"1.2.3", "USD", Money{}, ErrInvalidAmount},
+		{"1e3", "USD", Money{}, ErrInvalidAmount},
+		{"12,30", "USD", Money{}, ErrInvalidAmount},
+		{"1", "US", Money{}, ErrInvalidCurrency},
+		{"1", "U$D", Money{}, ErrInvalidCurrency},
+		{"92233720368547758.07", "USD", Money{math.MaxInt64, "USD"}, nil},
+		{"92233720368547758.08", "USD", Money{}, ErrOverflow},
+		{"92233720368547758.065", "USD", Money{math.MaxInt64 - 1, "USD"}, nil},
+		{"92233720368547758.075", "USD", Money{}, ErrOverflow},
+		{"100000000000000000000", "USD", Money{}, ErrOverflow},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.amount, tt.currency)
+		if err != tt.err || got != tt.want {
+			t.Errorf("Parse(%q, %q) = %v, %v; want %v, %v", tt.amount, tt.currency, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		a, b Money
+		want Money
+		err  error
+	}{
+		{Money{150, "USD"}, Money{275, "USD"}, Money{425, "USD"}, nil},
+		{Money{150, "USD"}, Money{-275, "USD"}, Money{-125, "USD"}, nil},
+		{Money{150, "USD"}, Money{150, "EUR"}, Money{}, ErrCurrencyMismatch},
+		{Money{math.MaxInt64 - 1, "USD"}, Money{1, "USD"}, Money{math.MaxInt64, "USD"}, nil},
+		{Money{math.MaxInt64, "USD"}, Money{1, "USD"}, Money{}, ErrOverflow},
+		{Money{math.MinInt64 + 1, "USD"}, Money{-1, "USD"}, Money{math.MinInt64, "USD"}, nil},
+		{Money{math.MinInt64, "USD"}, Money{-1, "USD"}, Money{}, ErrOverflow},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.a.Add(tt.b)
+		if err != tt.err || got != tt.want {
+			t.Errorf("%v.Add(%v) = %v, %v; want %v, %v", tt.a, tt.b, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestMul(t *testing.T) {
+	tests := []struct {
+		m        Money
+		quantity uint32
+		want     Money
+		err      error
+	}{
+		{Money{1999, "USD"}, 3, Money{5997, "USD"}, nil},
+		{Money{1999, "USD"}, 0, Money{0, "USD"}, nil},
+		{Money{-250, "USD"}, 4, Money{-1000, "USD"}, nil},
+		{Money{math.MaxInt64, "USD"}, 1, Money{math.MaxInt64, "USD"}, nil},
+		{Money{math.MaxInt64/2 + 1, "USD"}, 2, Money{}, ErrOverflow},
+		{Money{math.MinInt64 / 2, "USD"}, 2, Money{math.MinInt64, "USD"}, nil},
+		{Money{math.MinInt64/2 - 1, "USD"}, 2, Money{}, ErrOverflow},
+		{Money{math.MaxInt64 / math.MaxUint32, "USD"}, math.MaxUint32, Money{math.MaxInt64 / math.MaxUint32 * math.MaxUint32, "USD"}, nil},
+		{Money{math.MaxInt64/math.MaxUint32 + 1, "USD"}, math.MaxUint32, Money{}, ErrOverflow},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.m.Mul(tt.quantity)
+		if err != tt.err || got != tt.want {
+			t.Errorf("%v.Mul(%d) = %v, %v; want %v, %v", tt.m, tt.quantity, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{Money{1230, "USD"}, "12.30"},
+		{Money{5, "USD"}, "0.05"},
+		{Money{-5, "USD"}, "-0.05"},
+		{Money{1500, "JPY"}, "1500"},
+		{Money{1234, "KWD"}, "1.234"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("%#v.String() = %q; want %q", tt.m, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package money
+
+import "github.com/jaykapade/cart-microservice/money/pb"
+
+func ToProto(m Money) *pb.Money {
+	return &pb.Money{Amount: m.Amount, Currency: m.Currency}
+}
+
+func FromProto(m *pb.Money) Money {
+	return New(m.GetAmount(), m.GetCurrency())
+}
@@ -0,0 +1,117 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrInvalidRecipient = errors.New("invalid recipient")
+
+// Mailbox is a Notifier for local development and testing. Instead of
+// sending messages it writes each one as an .eml file to
+// <dir>/<account ID>/, where any mail client can open it.
+type Mailbox struct {
+	dir  string
+	from string
+}
+
+func NewMailbox(dir string, from string) (*Mailbox, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Mailbox{dir: dir, from: from}, nil
+}
+
+func (b *Mailbox) Notify(ctx context.Context, m Message) error {
+	accountID := m.To.AccountID
+	if accountID == "" || strings.ContainsAny(accountID, `./\`) {
+		return ErrInvalidRecipient
+	}
+	dir := filepath.Join(b.dir, accountID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	raw, err := b.format(m)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary name first so readers never see a partial file.
+	name := filepath.Join(dir, m.CreatedAt.UTC().Format("20060102T150405")+"-"+m.ID+".eml")
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// format renders m as a multipart/alternative MIME message.
+func (b *Mailbox) format(m Message) ([]byte, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	}
+	for _, p := range parts {
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(pw)
+		if _, err := qp.Write([]byte(p.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	header := func(key string, value string) {
+		fmt.Fprintf(&msg, "%s: %s\r\n", key, value)
+	}
+	header("Message-ID", "<"+m.ID+"@"+b.domain()+">")
+	header("Date", m.CreatedAt.Format(time.RFC1123Z))
+	header("From", b.from)
+	if m.To.Email != "" {
+		header("To", (&mail.Address{Name: m.To.Name, Address: m.To.Email}).String())
+	}
+	header("X-Account-ID", m.To.AccountID)
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/alternative; boundary="+w.Boundary())
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+func (b *Mailbox) domain() string {
+	if a, err := mail.ParseAddress(b.from); err == nil {
+		if _, domain, ok := strings.Cut(a.Address, "@"); ok {
+			return domain
+		}
+	}
+	return "localhost"
+}
@@ -0,0 +1,158 @@
+package notify
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMailbox(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewMailbox(dir, "Cart <shop@cart.example>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := Message{
+		ID:        "msg1",
+		To:        Recipient{AccountID: "acc1", Name: "Ada Lovelace", Email: "ada@example.com"},
+		Subject:   "Grüße",
+		Text:      "Hi Ada,\n",
+		HTML:      "<p>Hi Ada,</p>",
+		CreatedAt: time.Date(2024, time.March, 5, 14, 30, 0, 0, time.UTC),
+	}
+	if err := b.Notify(context.Background(), m); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "acc1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	// Only the renamed file is left behind, not the temporary one.
+	want := "20240305T143000-msg1.eml"
+	if len(names) != 1 || names[0] != want {
+		t.Fatalf("mailbox holds %v; want [%s]", names, want)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "acc1", want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	msg, err := mail.ReadMessage(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{
+		"Message-ID":   "<msg1@cart.example>",
+		"Date":         "Tue, 05 Mar 2024 14:30:00 +0000",
+		"From":         "Cart <shop@cart.example>",
+		"To":           `"Ada Lovelace" <ada@example.com>`,
+		"X-Account-ID": "acc1",
+		"MIME-Version": "1.0",
+	}
+	for key, want := range headers {
+		if got := msg.Header.Get(key); got != want {
+			t.Errorf("%s = %q; want %q", key, got, want)
+		}
+	}
+	if subject != m.Subject {
+		t.Errorf("Subject = %q; want %q", subject, m.Subject)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, %v; want multipart/alternative", msg.Header.Get("Content-Type"), err)
+	}
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	}
+	for _, want := range parts {
+		p, err := r.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.Header.Get("Content-Type"); got != want.contentType {
+			t.Errorf("part Content-Type = %q; want %q", got, want.contentType)
+		}
+		// Quoted-printable text ends lines with CRLF, as mail does.
+		if got := strings.ReplaceAll(string(content), "\r\n", "\n"); got != want.content {
+			t.Errorf("part content = %q; want %q", content, want.content)
+		}
+	}
+	if _, err := r.NextPart(); err != io.EOF {
+		t.Errorf("message has more than two parts: %v", err)
+	}
+}
+
+func TestMailboxWithoutEmail(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewMailbox(dir, "shop@cart.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := Message{ID: "msg1", To: Recipient{AccountID: "acc1"}, CreatedAt: time.Now()}
+	if err := b.Notify(context.Background(), m); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "acc1"))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("mailbox holds %v, %v; want one message", entries, err)
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, "acc1", entries[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "\r\nTo:") {
+		t.Errorf("message without an email has a To header:\n%s", raw)
+	}
+	if !strings.Contains(string(raw), "Message-ID: <msg1@cart.example>\r\n") {
+		t.Errorf("message has no Message-ID in the sender's domain:\n%s", raw)
+	}
+}
+
+func TestMailboxInvalidRecipient(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewMailbox(dir, "shop@cart.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, accountID := range []string{"", "..", "a/b", `a\b`, "a.b"} {
+		m := Message{ID: "msg1", To: Recipient{AccountID: accountID}, CreatedAt: time.Now()}
+		if err := b.Notify(context.Background(), m); err != ErrInvalidRecipient {
+			t.Errorf("Notify to %q = %v; want %v", accountID, err, ErrInvalidRecipient)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("mailbox directory holds %v, %v; want nothing", entries, err)
+	}
+}
@@ -0,0 +1,41 @@
+// Package notify renders messages for customers and hands them to a
+// transport. Services depend only on the Notifier interface; which transport
+// is used is decided when the service starts.
+package notify
+
+import (
+	"context"
+	"time"
+)
+
+// Recipient is who a message is for. Email is empty when the sender only
+// knows the account, e.g. accounts created without credentials; transports
+// that deliver by email skip or look up such recipients.
+type Recipient struct {
+	AccountID string
+	Name      string
+	Email     string
+}
+
+type Message struct {
+	ID        string
+	To        Recipient
+	Subject   string
+	Text      string
+	HTML      string
+	CreatedAt time.Time
+}
+
+// Notifier delivers messages.
+type Notifier interface {
+	Notify(ctx context.Context, m Message) error
+}
+
+// Discard is a Notifier that drops every message.
+var Discard Notifier = discard{}
+
+type discard struct{}
+
+func (discard) Notify(ctx context.Context, m Message) error {
+	return nil
+}
@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	ErrQueueFull   = errors.New("notification queue is full")
+	ErrQueueClosed = errors.New("notification queue is closed")
+)
+
+// sendTimeout bounds the delivery of a single queued message.
+const sendTimeout = 10 * time.Second
+
+// Queue is a Notifier that hands messages to another Notifier in the
+// background, so callers never wait for delivery. When the buffer is full new
+// messages are rejected with ErrQueueFull rather than blocking, and once the
+// queue is closed with ErrQueueClosed.
+type Queue struct {
+	next     Notifier
+	messages chan Message
+	done     chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewQueue(next Notifier, size int) *Queue {
+	q := &Queue{
+		next:     next,
+		messages: make(chan Message, size),
+		done:     make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+func (q *Queue) Notify(ctx context.Context, m Message) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.messages <- m:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting messages and waits for the queued ones to be sent.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.messages)
+	}
+	q.mu.Unlock()
+	<-q.done
+}
+
+func (q *Queue) run() {
+	defer close(q.done)
+	for m := range q.messages {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		if err := q.next.Notify(ctx, m); err != nil {
+			log.Println("Error sending notification", m.ID, err)
+		}
+		cancel()
+	}
+}
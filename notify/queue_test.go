@@ -0,0 +1,134 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingNotifier records the messages it is given. While blocked it holds
+// each one until unblocked, announcing it on started.
+type blockingNotifier struct {
+	started chan string
+	release chan struct{}
+
+	mu   sync.Mutex
+	sent []string
+}
+
+func newBlockingNotifier() *blockingNotifier {
+	return &blockingNotifier{
+		started: make(chan string, 10),
+		release: make(chan struct{}),
+	}
+}
+
+func (n *blockingNotifier) Notify(ctx context.Context, m Message) error {
+	n.started <- m.ID
+	<-n.release
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, m.ID)
+	if m.ID == "fail" {
+		return errors.New("delivery failed")
+	}
+	return nil
+}
+
+func (n *blockingNotifier) messages() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.sent...)
+}
+
+func TestQueueOverflow(t *testing.T) {
+	next := newBlockingNotifier()
+	q := NewQueue(next, 1)
+	ctx := context.Background()
+
+	// The first message is taken by the sender, the second waits in the
+	// buffer and the third does not fit.
+	if err := q.Notify(ctx, Message{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	waitStarted(t, next, "1")
+	if err := q.Notify(ctx, Message{ID: "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Notify(ctx, Message{ID: "3"}); err != ErrQueueFull {
+		t.Fatalf("Notify on a full queue = %v; want %v", err, ErrQueueFull)
+	}
+
+	close(next.release)
+	q.Close()
+	if got := next.messages(); !equalStrings(got, []string{"1", "2"}) {
+		t.Errorf("sent %v; want [1 2]", got)
+	}
+}
+
+func TestQueueClose(t *testing.T) {
+	next := newBlockingNotifier()
+	q := NewQueue(next, 10)
+	ctx := context.Background()
+
+	for _, id := range []string{"1", "fail", "3"} {
+		if err := q.Notify(ctx, Message{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitStarted(t, next, "1")
+
+	closed := make(chan struct{})
+	go func() {
+		q.Close()
+		close(closed)
+	}()
+
+	// Close waits for the queued messages, even after one fails.
+	select {
+	case <-closed:
+		t.Fatal("Close returned before the queued messages were sent")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(next.release)
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return")
+	}
+	if got := next.messages(); !equalStrings(got, []string{"1", "fail", "3"}) {
+		t.Errorf("sent %v; want [1 fail 3]", got)
+	}
+
+	if err := q.Notify(ctx, Message{ID: "4"}); err != ErrQueueClosed {
+		t.Errorf("Notify after Close = %v; want %v", err, ErrQueueClosed)
+	}
+	// Closing again is harmless.
+	q.Close()
+}
+
+func waitStarted(t *testing.T, n *blockingNotifier, id string) {
+	t.Helper()
+	select {
+	case got := <-n.started:
+		if got != id {
+			t.Fatalf("sending %q; want %q", got, id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%q was not sent", id)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
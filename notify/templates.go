@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+// Each message kind has a <name>.txt template, which also defines
+// <name>.subject, and a <name>.html template.
+//
+//go:embed templates
+var templateFS embed.FS
+
+var (
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/*.txt"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/*.html"))
+)
+
+// OrderPlaced describes an order for the order-placed message. Amounts are
+// already formatted, e.g. "12.30 EUR".
+type OrderPlaced struct {
+	OrderID         string
+	CreatedAt       time.Time
+	Lines           []OrderLine
+	Total           string
+	ShippingAddress []string
+}
+
+type OrderLine struct {
+	Name     string
+	SKU      string
+	Quantity uint32
+	Price    string
+}
+
+type templateData struct {
+	To    Recipient
+	Order *OrderPlaced
+}
+
+// AccountCreated renders the welcome message for a new account.
+func AccountCreated(to Recipient) (Message, error) {
+	return render("account_created", templateData{To: to})
+}
+
+// OrderPlacedMessage renders the confirmation of an order.
+func OrderPlacedMessage(to Recipient, o OrderPlaced) (Message, error) {
+	return render("order_placed", templateData{To: to, Order: &o})
+}
+
+func render(name string, data templateData) (Message, error) {
+	var subject, text, html bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&subject, name+".subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := textTemplates.ExecuteTemplate(&text, name+".txt", data); err != nil {
+		return Message{}, err
+	}
+	if err := htmlTemplates.ExecuteTemplate(&html, name+".html", data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		ID:        ksuid.New().String(),
+		To:        data.To,
+		Subject:   strings.TrimSpace(subject.String()),
+		Text:      strings.TrimSpace(text.String()) + "\n",
+		HTML:      html.String(),
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccountCreated(t *testing.T) {
+	tests := []struct {
+		to      Recipient
+		subject string
+		text    []string
+		html    []string
+	}{
+		{
+			Recipient{AccountID: "acc1", Name: "Ada", Email: "ada@example.com"},
+			"Welcome to Cart, Ada",
+			[]string{"Hi Ada,", "Your account ID is acc1."},
+			[]string{"<p>Hi Ada,</p>", "<code>acc1</code>"},
+		},
+		{
+			Recipient{AccountID: "acc2"},
+			"Welcome to Cart",
+			[]string{"Hi there,"},
+			[]string{"<p>Hi there,</p>"},
+		},
+		{
+			Recipient{AccountID: "acc3", Name: "<b>Bob</b>"},
+			"Welcome to Cart, <b>Bob</b>",
+			[]string{"Hi <b>Bob</b>,"},
+			[]string{"Hi &lt;b&gt;Bob&lt;/b&gt;,"},
+		},
+	}
+
+	for _, tt := range tests {
+		m, err := AccountCreated(tt.to)
+		if err != nil {
+			t.Fatalf("AccountCreated(%+v): %v", tt.to, err)
+		}
+		assertMessage(t, m, tt.to, tt.subject, tt.text, tt.html)
+	}
+}
+
+func TestOrderPlacedMessage(t *testing.T) {
+	to := Recipient{AccountID: "acc1", Name: "Ada", Email: "ada@example.com"}
+	o := OrderPlaced{
+		OrderID:   "ord1",
+		CreatedAt: time.Date(2024, time.March, 5, 14, 30, 0, 0, time.UTC),
+		Lines: []OrderLine{
+			{Name: "Shirt", SKU: "SHIRT-M", Quantity: 2, Price: "12.30 EUR"},
+			{Name: "Mug", Quantity: 1, Price: "5.00 EUR"},
+		},
+		Total:           "29.60 EUR",
+		ShippingAddress: []string{"Ada Lovelace", "1 Main St"},
+	}
+
+	m, err := OrderPlacedMessage(to, o)
+	if err != nil {
+		t.Fatalf("OrderPlacedMessage: %v", err)
+	}
+	assertMessage(t, m, to, "Your order ord1 has been placed",
+		[]string{
+			"Thank you for your order ord1, placed on 5 March 2024 at 14:30 UTC.",
+			"- 2 x Shirt (SHIRT-M): 12.30 EUR each",
+			"- 1 x Mug: 5.00 EUR each",
+			"Total: 29.60 EUR",
+			"Shipping to:\n  Ada Lovelace\n  1 Main St",
+		},
+		[]string{
+			"<strong>ord1</strong>",
+			"<td>Shirt (SHIRT-M)</td>",
+			"<td>Mug</td>",
+			"<strong>29.60 EUR</strong>",
+			"Ada Lovelace<br>",
+		},
+	)
+
+	o.ShippingAddress = nil
+	m, err = OrderPlacedMessage(to, o)
+	if err != nil {
+		t.Fatalf("OrderPlacedMessage: %v", err)
+	}
+	if strings.Contains(m.Text, "Shipping to") || strings.Contains(m.HTML, "Shipping to") {
+		t.Errorf("message without a shipping address mentions one:\n%s\n%s", m.Text, m.HTML)
+	}
+}
+
+func assertMessage(t *testing.T, m Message, to Recipient, subject string, text []string, html []string) {
+	t.Helper()
+	if m.ID == "" || m.CreatedAt.IsZero() {
+		t.Errorf("message has no ID or creation time: %+v", m)
+	}
+	if m.To != to {
+		t.Errorf("To = %+v; want %+v", m.To, to)
+	}
+	if m.Subject != subject {
+		t.Errorf("Subject = %q; want %q", m.Subject, subject)
+	}
+	for _, s := range text {
+		if !strings.Contains(m.Text, s) {
+			t.Errorf("Text does not contain %q:\n%s", s, m.Text)
+		}
+	}
+	for _, s := range html {
+		if !strings.Contains(m.HTML, s) {
+			t.Errorf("HTML does not contain %q:\n%s", s, m.HTML)
+		}
+	}
+}
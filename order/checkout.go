@@ -0,0 +1,243 @@
+package order
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jaykapade/cart-microservice/catalog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sagaResumeInterval is how often abandoned sagas are looked for.
+const sagaResumeInterval = time.Minute
+
+// reservationTTL is how long stock stays held for a saga. It must outlast
+// sagaLease so that a resumed saga still finds its reservation.
+const reservationTTL = 10 * time.Minute
+
+// checkoutSteps places an order: the account (and shipping address, if any)
+// must exist, lines are priced from the catalog, stock is reserved, the order
+// is stored and confirmed, and finally the customer is told.
+func (s *grpcServer) checkoutSteps() []SagaStep {
+	return []SagaStep{
+		{Name: "validate_account", Action: s.validateAccount},
+		{Name: "price_lines", Action: s.priceLines},
+		{Name: "reserve", Action: s.reserveStock, Compensate: s.releaseStock},
+		{Name: "persist", Action: s.persistOrder, Compensate: s.deleteOrder},
+		{Name: "confirm", Action: s.confirmOrder},
+		{Name: "notify", Action: s.notifyCustomer},
+	}
+}
+
+// validateAccount checks that the account exists and copies the requested
+// shipping address from its address book.
+func (s *grpcServer) validateAccount(ctx context.Context, saga *Saga) error {
+	_, err := s.accountClient.GetAccount(ctx, saga.Data.AccountID)
+	if err != nil {
+		return fmt.Errorf("getting account: %w", err)
+	}
+
+	if saga.Data.ShippingAddressID == "" {
+		return nil
+	}
+	a, err := s.accountClient.GetAddress(ctx, saga.Data.ShippingAddressID)
+	if status.Code(err) == codes.NotFound || (err == nil && a.AccountID != saga.Data.AccountID) {
+		return fmt.Errorf("%w: address %s", ErrInvalidAddress, saga.Data.ShippingAddressID)
+	}
+	if err != nil {
+		return fmt.Errorf("getting address: %w", err)
+	}
+	saga.Data.ShippingAddress = &ShippingAddress{
+		AddressID:  a.ID,
+		Recipient:  a.Recipient,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+	}
+	return nil
+}
+
+func (s *grpcServer) priceLines(ctx context.Context, saga *Saga) error {
+	productIDs := []string{}
+	for _, p := range saga.Data.Products {
+		productIDs = append(productIDs, p.ID)
+	}
+	if len(productIDs) == 0 {
+		return ErrEmptyOrder
+	}
+
+	catalogProducts, err := s.catalogClient.GetProducts(ctx, 0, 0, productIDs, "", catalog.ProductFilter{})
+	if err != nil {
+		return fmt.Errorf("getting products: %w", err)
+	}
+
+	byID := map[string]*catalog.Product{}
+	for _, pdt := range catalogProducts {
+		byID[pdt.ID] = pdt
+	}
+
+	// Repeated lines for the same product and SKU are merged into one.
+	products := []*OrderedProduct{}
+	lines := map[string]*OrderedProduct{}
+	for _, requested := range saga.Data.Products {
+		pdt, ok := byID[requested.ID]
+		if !ok || requested.Quantity == 0 {
+			continue
+		}
+
+		var variant *catalog.Variant
+		if requested.SKU != "" || len(pdt.Variants) > 0 {
+			variant = pdt.Variant(requested.SKU)
+			if variant == nil || !variant.Active {
+				return fmt.Errorf("%w: product %s sku %q", ErrInvalidVariant, pdt.ID, requested.SKU)
+			}
+		}
+
+		key := requested.ID + "/" + requested.SKU
+		if line, ok := lines[key]; ok {
+			line.Quantity += requested.Quantity
+			continue
+		}
+		price := pdt.PriceOf(variant)
+		line := &OrderedProduct{
+			ID:          pdt.ID,
+			SKU:         requested.SKU,
+			Name:        pdt.Name,
+			Description: pdt.Description,
+			Price:       &price,
+			Quantity:    requested.Quantity,
+		}
+		if variant != nil {
+			line.Attributes = variant.Attributes
+		}
+		lines[key] = line
+		products = append(products, line)
+	}
+
+	o, err := NewOrder(saga.ID, saga.Data.AccountID, products)
+	if err != nil {
+		return err
+	}
+	o.ShippingAddress = saga.Data.ShippingAddress
+	saga.Data.Order = o
+	return nil
+}
+
+// reserveStock holds the order's lines in the catalog under the saga ID, so
+// a retried step does not reserve twice.
+func (s *grpcServer) reserveStock(ctx context.Context, saga *Saga) error {
+	items := []catalog.ReservationItem{}
+	for _, p := range saga.Data.Order.Products {
+		items = append(items, catalog.ReservationItem{ProductID: p.ID, Quantity: p.Quantity})
+	}
+
+	_, err := s.catalogClient.Reserve(ctx, saga.ID, items, reservationTTL)
+	if status.Code(err) == codes.FailedPrecondition {
+		return fmt.Errorf("%w: %s", ErrOutOfStock, status.Convert(err).Message())
+	}
+	if err != nil {
+		return fmt.Errorf("reserving stock: %w", err)
+	}
+	return nil
+}
+
+func (s *grpcServer) releaseStock(ctx context.Context, saga *Saga) error {
+	return s.catalogClient.Release(ctx, saga.ID, orderProductIDs(saga.Data.Order))
+}
+
+func (s *grpcServer) persistOrder(ctx context.Context, saga *Saga) error {
+	o, err := s.service.PostOrder(ctx, saga.Data.Order, saga.Data.IdempotencyKey)
+	if err != nil {
+		return err
+	}
+	// On an idempotent replay o is the order placed by the first request.
+	saga.Data.Order = o
+	return nil
+}
+
+func (s *grpcServer) deleteOrder(ctx context.Context, saga *Saga) error {
+	if saga.Data.Order == nil || saga.Data.Order.ID != saga.ID {
+		return nil
+	}
+	return s.service.DeleteOrder(ctx, saga.ID)
+}
+
+// confirmOrder makes the reservation permanent. On an idempotent replay the
+// stock was committed by the original saga, so this saga's hold is released
+// instead. The step needs no compensation: Commit is all-or-nothing, so when
+// it fails the hold is still in place for releaseStock to give back.
+func (s *grpcServer) confirmOrder(ctx context.Context, saga *Saga) error {
+	productIDs := orderProductIDs(saga.Data.Order)
+	if saga.Data.Order.ID != saga.ID {
+		return s.catalogClient.Release(ctx, saga.ID, productIDs)
+	}
+	return s.catalogClient.Commit(ctx, saga.ID, productIDs)
+}
+
+// notifyCustomer confirms the order to its account once nothing can undo it
+// any more. An idempotent replay placed no new order, so nothing is sent.
+func (s *grpcServer) notifyCustomer(ctx context.Context, saga *Saga) error {
+	if saga.Data.Order.ID == saga.ID {
+		s.service.NotifyOrderPlaced(ctx, saga.Data.Order)
+	}
+	return nil
+}
+
+func orderProductIDs(o *Order) []string {
+	ids := []string{}
+	for _, p := range o.Products {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+// resumeSagas periodically finishes sagas abandoned by a stopped or stuck
+// run, either driving them to completion or compensating them. Each saga is
+// claimed first, so it is never resumed while another run holds its lease,
+// whether in this process or another replica.
+func (s *grpcServer) resumeSagas() {
+	for {
+		s.resumeStaleSagas()
+		time.Sleep(sagaResumeInterval)
+	}
+}
+
+func (s *grpcServer) resumeStaleSagas() {
+	ctx, cancel := context.WithTimeout(context.Background(), sagaResumeInterval)
+	sagas, err := s.service.ListStaleSagas(ctx, time.Now().UTC())
+	cancel()
+	if err != nil {
+		log.Println("Error listing stale sagas", err)
+		return
+	}
+	for _, saga := range sagas {
+		s.resumeSaga(saga.ID)
+	}
+}
+
+// resumeSaga claims the saga and runs it, unless another run claimed it
+// first.
+func (s *grpcServer) resumeSaga(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), sagaResumeInterval)
+	defer cancel()
+
+	saga, err := s.service.ClaimSaga(ctx, id, time.Now().UTC())
+	if err == ErrNotFound {
+		return
+	}
+	if err != nil {
+		log.Println("Error claiming saga", id, err)
+		return
+	}
+
+	if err := s.orchestrator.Run(ctx, saga); err != nil {
+		log.Println("Resumed saga", saga.ID, "ended with", saga.Status, err)
+	} else {
+		log.Println("Resumed saga", saga.ID, "completed")
+	}
+}
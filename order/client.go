@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/jaykapade/cart-microservice/money"
 	"github.com/jaykapade/cart-microservice/order/pb"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -27,61 +28,146 @@ func (c *Client) Close() {
 	c.conn.Close()
 }
 
-func (c *Client) GetOrdersForAccount(ctx context.Context, accountID string) ([]*Order, error) {
-	r, err := c.service.GetOrdersForAccount(ctx, &pb.GetOrdersForAccountRequest{AccountId: accountID})
+func (c *Client) GetOrder(ctx context.Context, id string) (*Order, error) {
+	r, err := c.service.GetOrder(ctx, &pb.GetOrderRequest{Id: id})
 	if err != nil {
 		return nil, err
 	}
 
+	return orderFromProto(r.Order), nil
+}
+
+func (c *Client) UpdateOrderStatus(ctx context.Context, id string, status Status) (*Order, error) {
+	r, err := c.service.UpdateOrderStatus(ctx, &pb.UpdateOrderStatusRequest{
+		Id:     id,
+		Status: string(status),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return orderFromProto(r.Order), nil
+}
+
+func (c *Client) GetOrdersForAccount(ctx context.Context, accountID string, filter OrderFilter, after string, take uint64) ([]*Order, string, error) {
+	r, err := c.service.GetOrdersForAccount(ctx, &pb.GetOrdersForAccountRequest{
+		AccountId: accountID,
+		Filter:    filterToProto(filter),
+		After:     after,
+		Take:      take,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
 	orders := []*Order{}
 	for _, orderProto := range r.Orders {
-		newOrder := &Order{
-			ID:         orderProto.Id,
-			AccountID:  orderProto.AccountId,
-			TotalPrice: orderProto.TotalPrice,
-		}
-		newOrder.CreatedAt = time.Time{}
-		newOrder.CreatedAt.UnmarshalBinary(orderProto.CreatedAt)
-
-		products := []*OrderedProduct{}
-		for _, productProto := range orderProto.Products {
-			products = append(products, &OrderedProduct{
-				ID:       productProto.Id,
-				Quantity: productProto.Quantity,
-			})
-		}
-		newOrder.Products = products
-		orders = append(orders, newOrder)
+		orders = append(orders, orderFromProto(orderProto))
+	}
+
+	return orders, r.NextCursor, nil
+
+}
+
+func (c *Client) ListOrders(ctx context.Context, filter OrderFilter, after string, take uint64) ([]*Order, string, error) {
+	r, err := c.service.ListOrders(ctx, &pb.ListOrdersRequest{
+		Filter: filterToProto(filter),
+		After:  after,
+		Take:   take,
+	})
+	if err != nil {
+		return nil, "", err
 	}
 
-	return orders, nil
+	orders := []*Order{}
+	for _, orderProto := range r.Orders {
+		orders = append(orders, orderFromProto(orderProto))
+	}
 
+	return orders, r.NextCursor, nil
 }
 
-func (c *Client) PostOrder(ctx context.Context, accountID string, products []*OrderedProduct) (*Order, error) {
+// AnonymizeAccountOrders detaches the orders of a deleted account from it and
+// returns how many there were.
+func (c *Client) AnonymizeAccountOrders(ctx context.Context, accountID string) (uint64, error) {
+	r, err := c.service.AnonymizeAccountOrders(ctx, &pb.AnonymizeAccountOrdersRequest{AccountId: accountID})
+	if err != nil {
+		return 0, err
+	}
+	return r.Orders, nil
+}
+
+// PostOrder places an order. shippingAddressID names an entry of the
+// account's address book and may be empty.
+func (c *Client) PostOrder(ctx context.Context, accountID string, shippingAddressID string, products []*OrderedProduct, idempotencyKey string) (*Order, error) {
 	protoProducts := []*pb.PostOrderRequest_OrderedProduct{}
 	for _, p := range products {
 		protoProducts = append(protoProducts, &pb.PostOrderRequest_OrderedProduct{
 			ProductId: p.ID,
+			Sku:       p.SKU,
 			Quantity:  p.Quantity,
 		})
 	}
 	r, err := c.service.PostOrder(ctx, &pb.PostOrderRequest{
-		AccountId: accountID,
-		Products:  protoProducts,
+		AccountId:         accountID,
+		Products:          protoProducts,
+		IdempotencyKey:    idempotencyKey,
+		ShippingAddressId: shippingAddressID,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	newOrder := r.Order
-	newOrderCreatedAt := time.Time{}
-	newOrderCreatedAt.UnmarshalBinary(newOrder.CreatedAt)
-	return &Order{
-		ID:         newOrder.Id,
-		CreatedAt:  newOrderCreatedAt,
-		AccountID:  newOrder.AccountId,
-		TotalPrice: newOrder.TotalPrice,
-		Products:   products,
-	}, nil
+	return orderFromProto(r.Order), nil
+}
+
+func orderFromProto(orderProto *pb.Order) *Order {
+	newOrder := &Order{
+		ID:         orderProto.Id,
+		AccountID:  orderProto.AccountId,
+		TotalPrice: money.FromProto(orderProto.TotalPrice),
+		Status:     Status(orderProto.Status),
+	}
+	newOrder.CreatedAt = time.Time{}
+	newOrder.CreatedAt.UnmarshalBinary(orderProto.CreatedAt)
+
+	if a := orderProto.ShippingAddress; a != nil {
+		newOrder.ShippingAddress = &ShippingAddress{
+			AddressID:  a.AddressId,
+			Recipient:  a.Recipient,
+			Line1:      a.Line1,
+			Line2:      a.Line2,
+			City:       a.City,
+			PostalCode: a.PostalCode,
+			Country:    a.Country,
+		}
+	}
+
+	history := []*StatusChange{}
+	for _, changeProto := range orderProto.StatusHistory {
+		change := &StatusChange{Status: Status(changeProto.Status)}
+		change.CreatedAt.UnmarshalBinary(changeProto.CreatedAt)
+		history = append(history, change)
+	}
+	newOrder.StatusHistory = history
+
+	products := []*OrderedProduct{}
+	for _, productProto := range orderProto.Products {
+		product := &OrderedProduct{
+			ID:          productProto.Id,
+			SKU:         productProto.Sku,
+			Name:        productProto.Name,
+			Description: productProto.Description,
+			Attributes:  productProto.Attributes,
+			Quantity:    productProto.Quantity,
+		}
+		if productProto.Price != nil {
+			price := money.FromProto(productProto.Price)
+			product.Price = &price
+		}
+		products = append(products, product)
+	}
+	newOrder.Products = products
+
+	return newOrder
 }
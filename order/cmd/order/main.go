@@ -4,6 +4,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/jaykapade/cart-microservice/notify"
 	"github.com/jaykapade/cart-microservice/order"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/tinrab/retry"
@@ -13,6 +14,8 @@ type Config struct {
 	DatabaseURL string `envconfig:"DATABASE_URL"`
 	AccountURL  string `envconfig:"ACCOUNT_SERVICE_URL"`
 	CatalogURL  string `envconfig:"CATALOG_SERVICE_URL"`
+	MailboxDir  string `envconfig:"MAILBOX_DIR"`
+	MailFrom    string `envconfig:"MAIL_FROM" default:"Cart <no-reply@cart.localhost>"`
 }
 
 func main() {
@@ -32,7 +35,19 @@ func main() {
 		return err
 	})
 	defer r.Close()
+
+	notifier := notify.Discard
+	if cfg.MailboxDir != "" {
+		mailbox, err := notify.NewMailbox(cfg.MailboxDir, cfg.MailFrom)
+		if err != nil {
+			log.Fatal(err)
+		}
+		queue := notify.NewQueue(mailbox, 100)
+		defer queue.Close()
+		notifier = queue
+	}
+
 	log.Println("Listening on port 8080...")
-	s := order.NewOrderService(r)
+	s := order.NewOrderService(r, notifier)
 	log.Fatal(order.ListenGRPC(s, cfg.AccountURL, cfg.CatalogURL, 8080))
 }
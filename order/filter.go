@@ -0,0 +1,47 @@
+package order
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jaykapade/cart-microservice/keyset"
+	"github.com/jaykapade/cart-microservice/money"
+)
+
+var (
+	ErrInvalidCursor = keyset.ErrInvalidCursor
+	ErrInvalidFilter = errors.New("invalid order filter")
+)
+
+type Sort string
+
+const (
+	SortNewestFirst Sort = "newest_first"
+	SortOldestFirst Sort = "oldest_first"
+)
+
+// OrderFilter narrows an order listing. Zero values leave a field unfiltered.
+// Total bounds only match orders in the bound's currency.
+type OrderFilter struct {
+	AccountID     string
+	ProductID     string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	MinTotal      *money.Money
+	MaxTotal      *money.Money
+	Sort          Sort
+}
+
+func (f OrderFilter) Validate() error {
+	if f.Sort != "" && f.Sort != SortNewestFirst && f.Sort != SortOldestFirst {
+		return ErrInvalidFilter
+	}
+	if !f.CreatedAfter.IsZero() && !f.CreatedBefore.IsZero() && f.CreatedBefore.Before(f.CreatedAfter) {
+		return ErrInvalidFilter
+	}
+	if f.MinTotal != nil && f.MaxTotal != nil &&
+		(f.MinTotal.Currency != f.MaxTotal.Currency || f.MaxTotal.Amount < f.MinTotal.Amount) {
+		return ErrInvalidFilter
+	}
+	return nil
+}
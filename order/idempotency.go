@@ -0,0 +1,52 @@
+package order
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	ErrIdempotencyKeyReused    = errors.New("idempotency key reused with a different request")
+	ErrDuplicateIdempotencyKey = errors.New("duplicate idempotency key")
+)
+
+// IdempotencyKey ties a client-supplied key to the order it created and to a
+// fingerprint of the request, so replays can be told apart from key reuse.
+type IdempotencyKey struct {
+	Key         string
+	Fingerprint string
+	OrderID     string
+}
+
+// Fingerprint hashes the account, the shipping address ID and the requested
+// product quantities. Line order and repeated product IDs do not change the
+// result.
+func Fingerprint(accountID string, shippingAddressID string, products []*OrderedProduct) string {
+	quantities := map[string]uint64{}
+	ids := []string{}
+	for _, p := range products {
+		id := p.ID
+		if p.SKU != "" {
+			id += "/" + p.SKU
+		}
+		if _, ok := quantities[id]; !ok {
+			ids = append(ids, id)
+		}
+		quantities[id] += uint64(p.Quantity)
+	}
+	sort.Strings(ids)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", accountID)
+	for _, id := range ids {
+		fmt.Fprintf(h, "%s:%d\n", id, quantities[id])
+	}
+	// Only hashed when set, so keys used before addresses existed still match.
+	if shippingAddressID != "" {
+		fmt.Fprintf(h, "address:%s\n", shippingAddressID)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -3,15 +3,35 @@ package order
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"strings"
+	"time"
 
+	"github.com/jaykapade/cart-microservice/keyset"
+	"github.com/jaykapade/cart-microservice/money"
 	"github.com/lib/pq"
 )
 
+var (
+	ErrNotFound = errors.New("not found")
+)
+
 type Repository interface {
 	Close()
-	GetOrdersForAccount(ctx context.Context, accountID string) ([]*Order, error)
-	PutOrder(ctx context.Context, o *Order) error
+	GetOrder(ctx context.Context, id string) (*Order, error)
+	ListOrders(ctx context.Context, filter OrderFilter, after *keyset.Cursor, take uint64) ([]*Order, error)
+	PutOrder(ctx context.Context, o *Order, key *IdempotencyKey) error
+	GetIdempotencyKey(ctx context.Context, accountID string, key string) (*IdempotencyKey, error)
+	DeleteOrder(ctx context.Context, id string) error
+	PutSaga(ctx context.Context, saga *Saga) error
+	GetSaga(ctx context.Context, id string) (*Saga, error)
+	ListStaleSagas(ctx context.Context, now time.Time) ([]*Saga, error)
+	ClaimSaga(ctx context.Context, id string, owner string, leaseUntil time.Time, now time.Time) (*Saga, error)
+	UpdateOrderStatus(ctx context.Context, id string, from Status, change *StatusChange) error
+	AnonymizeAccount(ctx context.Context, accountID string) (int64, error)
 }
 
 type PostgresRepository struct {
@@ -35,68 +55,139 @@ func NewPostgresRepository(url string) (Repository, error) {
 func (r *PostgresRepository) Close() {
 	r.db.Close()
 }
-func (r *PostgresRepository) GetOrdersForAccount(ctx context.Context, accountID string) ([]*Order, error) {
+
+func (r *PostgresRepository) GetOrder(ctx context.Context, id string) (*Order, error) {
 	rows, err := r.db.QueryContext(
 		ctx,
-		`SELECT 
+		`SELECT
 		o.id,
 		o.created_at,
 		o.account_id,
-		o.total_price::money::numeric::float8,
+		o.total_price,
+		o.currency,
+		o.status,
+		o.shipping_address,
 		op.product_id,
+		op.sku,
+		op.name,
+		op.description,
+		op.attributes,
+		op.price,
+		op.currency,
 		op.quantity
-		FROM orders o JOIN order_products op ON o.id = op.order_id 
-		WHERE o.account_id = $1
-		ORDER BY o.created_at DESC`,
-		accountID,
+		FROM orders o JOIN order_products op ON o.id = op.order_id
+		WHERE o.id = $1`,
+		id,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	orders := []*Order{}
-	order := &Order{}
-	lastOrder := &Order{}
-	orderedProduct := &OrderedProduct{}
-	products := []*OrderedProduct{}
+	orders, err := scanOrders(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, ErrNotFound
+	}
 
-	for rows.Next() {
-		err := rows.Scan(
-			&order.ID,
-			&order.CreatedAt,
-			&order.AccountID,
-			&order.TotalPrice,
-			&orderedProduct.ID,
-			&orderedProduct.Quantity,
-		)
-		if err != nil {
-			return nil, err
-		}
-		if lastOrder.ID != "" && lastOrder.ID != order.ID {
-			newOrder := &Order{
-				ID:         lastOrder.ID,
-				CreatedAt:  lastOrder.CreatedAt,
-				AccountID:  lastOrder.AccountID,
-				TotalPrice: lastOrder.TotalPrice,
-				Products:   lastOrder.Products,
-			}
+	if err := r.loadStatusHistory(ctx, orders); err != nil {
+		return nil, err
+	}
 
-			orders = append(orders, newOrder)
-			products = []*OrderedProduct{}
-		}
-		products = append(products, &OrderedProduct{
-			ID:       orderedProduct.ID,
-			Quantity: orderedProduct.Quantity,
-		})
-		*lastOrder = *order
+	return orders[0], nil
+}
+
+// ListOrders returns up to take orders matching filter, starting after the
+// cursor in the filter's sort order.
+func (r *PostgresRepository) ListOrders(ctx context.Context, filter OrderFilter, after *keyset.Cursor, take uint64) ([]*Order, error) {
+	conds := []string{}
+	args := []interface{}{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
 	}
 
-	return orders, nil
+	if filter.AccountID != "" {
+		conds = append(conds, "account_id = "+arg(filter.AccountID))
+	}
+	if filter.ProductID != "" {
+		conds = append(conds, "id IN (SELECT order_id FROM order_products WHERE product_id = "+arg(filter.ProductID)+")")
+	}
+	if !filter.CreatedAfter.IsZero() {
+		conds = append(conds, "created_at >= "+arg(filter.CreatedAfter))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		conds = append(conds, "created_at < "+arg(filter.CreatedBefore))
+	}
+	if filter.MinTotal != nil {
+		conds = append(conds, "currency = "+arg(filter.MinTotal.Currency))
+		conds = append(conds, "total_price >= "+arg(filter.MinTotal.Amount))
+	}
+	if filter.MaxTotal != nil {
+		conds = append(conds, "currency = "+arg(filter.MaxTotal.Currency))
+		conds = append(conds, "total_price <= "+arg(filter.MaxTotal.Amount))
+	}
+
+	direction, cmp := "DESC", "<"
+	if filter.Sort == SortOldestFirst {
+		direction, cmp = "ASC", ">"
+	}
+	if after != nil {
+		conds = append(conds, fmt.Sprintf("(created_at, id) %s (%s, %s)", cmp, arg(after.CreatedAt), arg(after.ID)))
+	}
+
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+	orderBy := fmt.Sprintf("ORDER BY created_at %s, id %s", direction, direction)
+
+	rows, err := r.db.QueryContext(
+		ctx,
+		`SELECT
+		o.id,
+		o.created_at,
+		o.account_id,
+		o.total_price,
+		o.currency,
+		o.status,
+		o.shipping_address,
+		op.product_id,
+		op.sku,
+		op.name,
+		op.description,
+		op.attributes,
+		op.price,
+		op.currency,
+		op.quantity
+		FROM orders o JOIN order_products op ON o.id = op.order_id
+		WHERE o.id IN (SELECT id FROM orders `+where+` `+orderBy+` LIMIT `+arg(take)+`)
+		ORDER BY o.created_at `+direction+`, o.id `+direction,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders, err := scanOrders(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.loadStatusHistory(ctx, orders); err != nil {
+		return nil, err
+	}
 
+	return orders, nil
 }
 
-func (r *PostgresRepository) PutOrder(ctx context.Context, o *Order) error {
+// PutOrder stores the order and, when key is not nil, records the key in the
+// same transaction. A key already used by the account yields
+// ErrDuplicateIdempotencyKey.
+func (r *PostgresRepository) PutOrder(ctx context.Context, o *Order, key *IdempotencyKey) (err error) {
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -109,22 +200,58 @@ func (r *PostgresRepository) PutOrder(ctx context.Context, o *Order) error {
 		err = tx.Commit()
 	}()
 
+	shippingAddress := sql.NullString{}
+	if o.ShippingAddress != nil {
+		data, err := json.Marshal(o.ShippingAddress)
+		if err != nil {
+			return err
+		}
+		shippingAddress = sql.NullString{String: string(data), Valid: true}
+	}
+
 	_, err = tx.ExecContext(
 		ctx,
-		`INSERT INTO orders (id, created_at, account_id, total_price) VALUES ($1, $2, $3, $4)`,
+		`INSERT INTO orders (id, created_at, account_id, total_price, currency, status, shipping_address)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
 		o.ID,
 		o.CreatedAt,
 		o.AccountID,
-		o.TotalPrice,
+		o.TotalPrice.Amount,
+		o.TotalPrice.Currency,
+		o.Status,
+		shippingAddress,
 	)
 
 	if err != nil {
 		return err
 	}
 
-	stmt, _ := tx.PrepareContext(ctx, pq.CopyIn("order_products", "order_id", "product_id", "quantity"))
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("order_products", "order_id", "product_id", "sku", "name", "description", "attributes", "price", "currency", "quantity"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
 	for _, p := range o.Products {
-		_, err := stmt.ExecContext(ctx, o.ID, p.ID, p.Quantity)
+		attributes, err := json.Marshal(p.Attributes)
+		if err != nil {
+			return err
+		}
+		if p.Attributes == nil {
+			attributes = []byte("{}")
+		}
+		_, err = stmt.ExecContext(
+			ctx,
+			o.ID,
+			p.ID,
+			p.SKU,
+			p.Name,
+			p.Description,
+			string(attributes),
+			p.Price.Amount,
+			p.Price.Currency,
+			p.Quantity,
+		)
 		if err != nil {
 			return err
 		}
@@ -134,6 +261,411 @@ func (r *PostgresRepository) PutOrder(ctx context.Context, o *Order) error {
 		return err
 	}
 
-	stmt.Close()
+	for _, c := range o.StatusHistory {
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO order_status_history (order_id, status, created_at) VALUES ($1, $2, $3)`,
+			o.ID,
+			c.Status,
+			c.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if key != nil {
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO order_idempotency_keys (account_id, idempotency_key, fingerprint, order_id, created_at) VALUES ($1, $2, $3, $4, $5)`,
+			o.AccountID,
+			key.Key,
+			key.Fingerprint,
+			o.ID,
+			o.CreatedAt,
+		)
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			err = ErrDuplicateIdempotencyKey
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *PostgresRepository) GetIdempotencyKey(ctx context.Context, accountID string, key string) (*IdempotencyKey, error) {
+	row := r.db.QueryRowContext(
+		ctx,
+		`SELECT idempotency_key, fingerprint, order_id
+		FROM order_idempotency_keys
+		WHERE account_id = $1 AND idempotency_key = $2`,
+		accountID,
+		key,
+	)
+
+	k := &IdempotencyKey{}
+	err := row.Scan(&k.Key, &k.Fingerprint, &k.OrderID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// UpdateOrderStatus moves the order to change.Status only if it is still in
+// the from status, so concurrent updates cannot skip a transition check.
+func (r *PostgresRepository) UpdateOrderStatus(ctx context.Context, id string, from Status, change *StatusChange) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	res, err := tx.ExecContext(
+		ctx,
+		`UPDATE orders SET status = $1 WHERE id = $2 AND status = $3`,
+		change.Status,
+		id,
+		from,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		err = ErrInvalidTransition
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO order_status_history (order_id, status, created_at) VALUES ($1, $2, $3)`,
+		id,
+		change.Status,
+		change.CreatedAt,
+	)
+	return err
+}
+
+// DeleteOrder removes the order and its lines. Its status history and
+// idempotency key go with it through ON DELETE CASCADE.
+func (r *PostgresRepository) DeleteOrder(ctx context.Context, id string) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM order_products WHERE order_id = $1", id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM orders WHERE id = $1", id)
+	return err
+}
+
+// sagaColumns are the columns scanSagas reads, in order.
+const sagaColumns = "id, status, step, error, data, owner, lease_until, created_at, updated_at"
+
+// PutSaga stores the saga. An existing saga is only overwritten by the run
+// that owns it; otherwise ErrSagaLeaseLost is returned.
+func (r *PostgresRepository) PutSaga(ctx context.Context, saga *Saga) error {
+	data, err := json.Marshal(saga.Data)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.db.ExecContext(
+		ctx,
+		`INSERT INTO order_sagas (id, status, step, error, data, owner, lease_until, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO UPDATE SET
+		status = EXCLUDED.status,
+		step = EXCLUDED.step,
+		error = EXCLUDED.error,
+		data = EXCLUDED.data,
+		lease_until = EXCLUDED.lease_until,
+		updated_at = EXCLUDED.updated_at
+		WHERE order_sagas.owner = EXCLUDED.owner`,
+		saga.ID,
+		saga.Status,
+		saga.Step,
+		saga.Error,
+		data,
+		saga.Owner,
+		saga.LeaseUntil,
+		saga.CreatedAt,
+		saga.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrSagaLeaseLost
+	}
 	return nil
 }
+
+func (r *PostgresRepository) GetSaga(ctx context.Context, id string) (*Saga, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		"SELECT "+sagaColumns+" FROM order_sagas WHERE id = $1",
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sagas, err := scanSagas(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(sagas) == 0 {
+		return nil, ErrNotFound
+	}
+	return sagas[0], nil
+}
+
+// ListStaleSagas returns the unfinished sagas whose lease ran out before now.
+func (r *PostgresRepository) ListStaleSagas(ctx context.Context, now time.Time) ([]*Saga, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		"SELECT "+sagaColumns+` FROM order_sagas
+		WHERE status IN ($1, $2) AND lease_until < $3
+		ORDER BY created_at`,
+		SagaRunning,
+		SagaCompensating,
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSagas(rows)
+}
+
+// ClaimSaga hands an unfinished saga whose lease ran out before now to owner
+// and returns it as stored. Of several runs claiming the same saga only one
+// succeeds; the others get ErrNotFound.
+func (r *PostgresRepository) ClaimSaga(ctx context.Context, id string, owner string, leaseUntil time.Time, now time.Time) (*Saga, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`UPDATE order_sagas SET owner = $2, lease_until = $3
+		WHERE id = $1 AND status IN ($4, $5) AND lease_until < $6
+		RETURNING `+sagaColumns,
+		id,
+		owner,
+		leaseUntil,
+		SagaRunning,
+		SagaCompensating,
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sagas, err := scanSagas(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(sagas) == 0 {
+		return nil, ErrNotFound
+	}
+	return sagas[0], nil
+}
+
+func scanSagas(rows *sql.Rows) ([]*Saga, error) {
+	sagas := []*Saga{}
+	for rows.Next() {
+		saga := &Saga{}
+		var data []byte
+		err := rows.Scan(
+			&saga.ID,
+			&saga.Status,
+			&saga.Step,
+			&saga.Error,
+			&data,
+			&saga.Owner,
+			&saga.LeaseUntil,
+			&saga.CreatedAt,
+			&saga.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &saga.Data); err != nil {
+			return nil, err
+		}
+		sagas = append(sagas, saga)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sagas, nil
+}
+
+// scanOrders groups rows of an orders/order_products join into orders,
+// relying on the rows of each order being adjacent.
+func scanOrders(rows *sql.Rows) ([]*Order, error) {
+	orders := []*Order{}
+	var last *Order
+
+	for rows.Next() {
+		o := &Order{}
+		p := &OrderedProduct{}
+		var attributes, shippingAddress []byte
+		var price sql.NullInt64
+		var currency string
+		err := rows.Scan(
+			&o.ID,
+			&o.CreatedAt,
+			&o.AccountID,
+			&o.TotalPrice.Amount,
+			&o.TotalPrice.Currency,
+			&o.Status,
+			&shippingAddress,
+			&p.ID,
+			&p.SKU,
+			&p.Name,
+			&p.Description,
+			&attributes,
+			&price,
+			&currency,
+			&p.Quantity,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(attributes, &p.Attributes); err != nil {
+			return nil, err
+		}
+		if price.Valid {
+			p.Price = &money.Money{Amount: price.Int64, Currency: currency}
+		}
+		if last == nil || last.ID != o.ID {
+			if shippingAddress != nil {
+				o.ShippingAddress = &ShippingAddress{}
+				if err := json.Unmarshal(shippingAddress, o.ShippingAddress); err != nil {
+					return nil, err
+				}
+			}
+			last = o
+			orders = append(orders, o)
+		}
+		last.Products = append(last.Products, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (r *PostgresRepository) loadStatusHistory(ctx context.Context, orders []*Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	byID := map[string]*Order{}
+	ids := []string{}
+	for _, o := range orders {
+		byID[o.ID] = o
+		ids = append(ids, o.ID)
+	}
+
+	rows, err := r.db.QueryContext(
+		ctx,
+		`SELECT order_id, status, created_at
+		FROM order_status_history
+		WHERE order_id = ANY($1)
+		ORDER BY created_at, id`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderID string
+		c := &StatusChange{}
+		if err := rows.Scan(&orderID, &c.Status, &c.CreatedAt); err != nil {
+			return err
+		}
+		if o, ok := byID[orderID]; ok {
+			o.StatusHistory = append(o.StatusHistory, c)
+		}
+	}
+
+	return rows.Err()
+}
+
+// AnonymizeAccount moves the account's orders to DeletedAccountID and drops
+// their shipping addresses, leaving lines and totals in place. The account's
+// idempotency keys and finished sagas, which also identify it, are deleted.
+func (r *PostgresRepository) AnonymizeAccount(ctx context.Context, accountID string) (n int64, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	res, err := tx.ExecContext(
+		ctx,
+		"UPDATE orders SET account_id = $2, shipping_address = NULL WHERE account_id = $1",
+		accountID,
+		DeletedAccountID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	if n, err = res.RowsAffected(); err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM order_idempotency_keys WHERE account_id = $1", accountID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"DELETE FROM order_sagas WHERE data->>'accountId' = $1 AND status = ANY($2)",
+		accountID,
+		pq.Array([]string{string(SagaCompleted), string(SagaCompensated), string(SagaFailed)}),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
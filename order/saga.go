@@ -0,0 +1,187 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+// ErrSagaLeaseLost is returned when a saga cannot be saved because another
+// run has claimed it.
+var ErrSagaLeaseLost = errors.New("saga lease lost")
+
+// sagaLease is how long a run holds a saga after saving it. Once the lease
+// runs out the saga may be claimed and resumed by another run.
+const sagaLease = time.Minute
+
+// sagaStepTimeout bounds each action and compensation. It is shorter than
+// sagaLease, and the lease is renewed before every step, so a step still in
+// progress always holds the lease.
+const sagaStepTimeout = 20 * time.Second
+
+type SagaStatus string
+
+const (
+	SagaRunning      SagaStatus = "running"
+	SagaCompleted    SagaStatus = "completed"
+	SagaCompensating SagaStatus = "compensating"
+	SagaCompensated  SagaStatus = "compensated"
+	SagaFailed       SagaStatus = "failed"
+)
+
+// Saga tracks one checkout through its steps. Step counts the steps that
+// have completed; while compensating it counts the steps still to undo.
+// Owner identifies the run holding the saga's lease until LeaseUntil.
+type Saga struct {
+	ID         string
+	Status     SagaStatus
+	Step       int
+	Error      string
+	Data       SagaData
+	Owner      string
+	LeaseUntil time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// SagaData is the state steps hand to each other. It is persisted as JSON
+// with the saga so a resumed saga picks up where it stopped.
+type SagaData struct {
+	AccountID         string            `json:"accountId"`
+	ShippingAddressID string            `json:"shippingAddressId,omitempty"`
+	Products          []*OrderedProduct `json:"products"`
+	IdempotencyKey    *IdempotencyKey   `json:"idempotencyKey,omitempty"`
+	ShippingAddress   *ShippingAddress  `json:"shippingAddress,omitempty"`
+	Order             *Order            `json:"order,omitempty"`
+}
+
+func (s *Saga) Finished() bool {
+	return s.Status == SagaCompleted || s.Status == SagaCompensated || s.Status == SagaFailed
+}
+
+// SagaStep is one unit of work. A step may run more than once if the process
+// stops between its action and the saga being saved, so actions and
+// compensations must be idempotent.
+type SagaStep struct {
+	Name       string
+	Action     func(ctx context.Context, saga *Saga) error
+	Compensate func(ctx context.Context, saga *Saga) error
+}
+
+// SagaStore persists sagas. SaveSaga returns ErrSagaLeaseLost instead of
+// saving a saga now owned by another run.
+type SagaStore interface {
+	SaveSaga(ctx context.Context, saga *Saga) error
+}
+
+type Orchestrator struct {
+	store SagaStore
+	steps []SagaStep
+}
+
+func NewOrchestrator(store SagaStore, steps []SagaStep) *Orchestrator {
+	return &Orchestrator{store: store, steps: steps}
+}
+
+func NewSaga(id string, data SagaData) *Saga {
+	now := time.Now().UTC()
+	return &Saga{
+		ID:        id,
+		Status:    SagaRunning,
+		Data:      data,
+		Owner:     ksuid.New().String(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// StepName returns the name of the step the saga is on, or an empty string
+// once it has finished.
+func (o *Orchestrator) StepName(saga *Saga) string {
+	i := saga.Step
+	if saga.Status == SagaCompensating || saga.Status == SagaFailed {
+		i--
+	}
+	if saga.Status == SagaCompleted || saga.Status == SagaCompensated || i < 0 || i >= len(o.steps) {
+		return ""
+	}
+	return o.steps[i].Name
+}
+
+// Run drives the saga forward from its current step, saving it, and so
+// renewing its lease, before the first step and after every step. If a step
+// fails, the completed steps are compensated in reverse order and the step's
+// error is returned. Run stops with ErrSagaLeaseLost if another run claims
+// the saga.
+func (o *Orchestrator) Run(ctx context.Context, saga *Saga) error {
+	if err := o.save(ctx, saga); err != nil {
+		return err
+	}
+
+	var stepErr error
+	for saga.Status == SagaRunning && saga.Step < len(o.steps) {
+		if stepErr = runStep(ctx, o.steps[saga.Step].Action, saga); stepErr != nil {
+			saga.Status = SagaCompensating
+			saga.Error = stepErr.Error()
+		} else {
+			saga.Step++
+		}
+		if err := o.save(ctx, saga); err != nil {
+			return err
+		}
+	}
+
+	if saga.Status == SagaRunning {
+		saga.Status = SagaCompleted
+		if err := o.save(ctx, saga); err != nil {
+			return err
+		}
+	}
+	if saga.Status == SagaCompleted {
+		return nil
+	}
+
+	for saga.Status == SagaCompensating && saga.Step > 0 {
+		step := o.steps[saga.Step-1]
+		if step.Compensate != nil {
+			if err := runStep(ctx, step.Compensate, saga); err != nil {
+				saga.Status = SagaFailed
+				saga.Error += "; compensating " + step.Name + ": " + err.Error()
+				if err := o.save(ctx, saga); err != nil {
+					return err
+				}
+				break
+			}
+		}
+		saga.Step--
+		if err := o.save(ctx, saga); err != nil {
+			return err
+		}
+	}
+
+	if saga.Status == SagaCompensating {
+		saga.Status = SagaCompensated
+		if err := o.save(ctx, saga); err != nil {
+			return err
+		}
+	}
+
+	if stepErr == nil {
+		stepErr = errors.New(saga.Error)
+	}
+	return stepErr
+}
+
+func (o *Orchestrator) save(ctx context.Context, saga *Saga) error {
+	saga.UpdatedAt = time.Now().UTC()
+	saga.LeaseUntil = saga.UpdatedAt.Add(sagaLease)
+	return o.store.SaveSaga(ctx, saga)
+}
+
+func runStep(ctx context.Context, f func(ctx context.Context, saga *Saga) error, saga *Saga) error {
+	ctx, cancel := context.WithTimeout(ctx, sagaStepTimeout)
+	defer cancel()
+	return f(ctx, saga)
+}
@@ -0,0 +1,263 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeSagaStore records the status and step of every save. From the save
+// numbered loseLeaseAt on, it refuses saves as if another run had claimed the
+// saga.
+type fakeSagaStore struct {
+	saves       []savedSaga
+	loseLeaseAt int
+}
+
+type savedSaga struct {
+	Status SagaStatus
+	Step   int
+}
+
+func (s *fakeSagaStore) SaveSaga(ctx context.Context, saga *Saga) error {
+	if s.loseLeaseAt > 0 && len(s.saves)+1 >= s.loseLeaseAt {
+		return ErrSagaLeaseLost
+	}
+	if !saga.LeaseUntil.After(saga.UpdatedAt) {
+		return errors.New("saved without renewing the lease")
+	}
+	s.saves = append(s.saves, savedSaga{saga.Status, saga.Step})
+	return nil
+}
+
+// recordedSteps builds steps that log their actions and compensations. The
+// step named fail fails, and so does the compensation of failUndo.
+func recordedSteps(log *[]string, names []string, compensated map[string]bool, fail string, failUndo string) []SagaStep {
+	steps := []SagaStep{}
+	for _, name := range names {
+		name := name
+		step := SagaStep{
+			Name: name,
+			Action: func(ctx context.Context, saga *Saga) error {
+				if _, ok := ctx.Deadline(); !ok {
+					return errors.New("step without a deadline")
+				}
+				*log = append(*log, name)
+				if name == fail {
+					return errors.New(name + " failed")
+				}
+				return nil
+			},
+		}
+		if compensated[name] {
+			step.Compensate = func(ctx context.Context, saga *Saga) error {
+				*log = append(*log, "undo "+name)
+				if name == failUndo {
+					return errors.New("undo " + name + " failed")
+				}
+				return nil
+			}
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+func TestOrchestrator(t *testing.T) {
+	names := []string{"validate", "price", "reserve", "persist", "confirm"}
+	compensated := map[string]bool{"reserve": true, "persist": true}
+
+	tests := []struct {
+		name     string
+		status   SagaStatus
+		step     int
+		fail     string
+		failUndo string
+
+		wantLog    []string
+		wantStatus SagaStatus
+		wantStep   int
+		wantErr    string
+		wantSaves  []savedSaga
+	}{
+		{
+			name:       "completes in order",
+			status:     SagaRunning,
+			wantLog:    []string{"validate", "price", "reserve", "persist", "confirm"},
+			wantStatus: SagaCompleted,
+			wantStep:   5,
+			wantSaves: []savedSaga{
+				{SagaRunning, 0}, {SagaRunning, 1}, {SagaRunning, 2}, {SagaRunning, 3},
+				{SagaRunning, 4}, {SagaRunning, 5}, {SagaCompleted, 5},
+			},
+		},
+		{
+			name:       "compensates in reverse order",
+			status:     SagaRunning,
+			fail:       "confirm",
+			wantLog:    []string{"validate", "price", "reserve", "persist", "confirm", "undo persist", "undo reserve"},
+			wantStatus: SagaCompensated,
+			wantStep:   0,
+			wantErr:    "confirm failed",
+			wantSaves: []savedSaga{
+				{SagaRunning, 0}, {SagaRunning, 1}, {SagaRunning, 2}, {SagaRunning, 3}, {SagaRunning, 4},
+				{SagaCompensating, 4}, {SagaCompensating, 3}, {SagaCompensating, 2}, {SagaCompensating, 1},
+				{SagaCompensating, 0}, {SagaCompensated, 0},
+			},
+		},
+		{
+			name:       "fails the first step",
+			status:     SagaRunning,
+			fail:       "validate",
+			wantLog:    []string{"validate"},
+			wantStatus: SagaCompensated,
+			wantStep:   0,
+			wantErr:    "validate failed",
+			wantSaves:  []savedSaga{{SagaRunning, 0}, {SagaCompensating, 0}, {SagaCompensated, 0}},
+		},
+		{
+			name:       "stops at a failed compensation",
+			status:     SagaRunning,
+			fail:       "confirm",
+			failUndo:   "persist",
+			wantLog:    []string{"validate", "price", "reserve", "persist", "confirm", "undo persist"},
+			wantStatus: SagaFailed,
+			wantStep:   4,
+			wantErr:    "confirm failed",
+			wantSaves: []savedSaga{
+				{SagaRunning, 0}, {SagaRunning, 1}, {SagaRunning, 2}, {SagaRunning, 3}, {SagaRunning, 4},
+				{SagaCompensating, 4}, {SagaFailed, 4},
+			},
+		},
+		{
+			name:       "resumes a running saga",
+			status:     SagaRunning,
+			step:       3,
+			wantLog:    []string{"persist", "confirm"},
+			wantStatus: SagaCompleted,
+			wantStep:   5,
+			wantSaves:  []savedSaga{{SagaRunning, 3}, {SagaRunning, 4}, {SagaRunning, 5}, {SagaCompleted, 5}},
+		},
+		{
+			name:       "resumes a compensating saga",
+			status:     SagaCompensating,
+			step:       3,
+			wantLog:    []string{"undo reserve"},
+			wantStatus: SagaCompensated,
+			wantStep:   0,
+			wantErr:    "confirm failed",
+			wantSaves: []savedSaga{
+				{SagaCompensating, 3}, {SagaCompensating, 2}, {SagaCompensating, 1},
+				{SagaCompensating, 0}, {SagaCompensated, 0},
+			},
+		},
+		{
+			name:       "leaves a finished saga alone",
+			status:     SagaCompleted,
+			step:       5,
+			wantLog:    []string{},
+			wantStatus: SagaCompleted,
+			wantStep:   5,
+			wantSaves:  []savedSaga{{SagaCompleted, 5}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := []string{}
+			store := &fakeSagaStore{}
+			o := NewOrchestrator(store, recordedSteps(&log, names, compensated, tt.fail, tt.failUndo))
+
+			saga := NewSaga("saga1", SagaData{})
+			saga.Status = tt.status
+			saga.Step = tt.step
+			if tt.status == SagaCompensating {
+				saga.Error = "confirm failed"
+			}
+
+			err := o.Run(context.Background(), saga)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("Run = %v; want %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(log, tt.wantLog) {
+				t.Errorf("ran %v; want %v", log, tt.wantLog)
+			}
+			if saga.Status != tt.wantStatus || saga.Step != tt.wantStep {
+				t.Errorf("saga ended %s at step %d; want %s at step %d", saga.Status, saga.Step, tt.wantStatus, tt.wantStep)
+			}
+			if !reflect.DeepEqual(store.saves, tt.wantSaves) {
+				t.Errorf("saved %v; want %v", store.saves, tt.wantSaves)
+			}
+		})
+	}
+}
+
+func TestOrchestratorLeaseLost(t *testing.T) {
+	log := []string{}
+	store := &fakeSagaStore{loseLeaseAt: 3}
+	o := NewOrchestrator(store, recordedSteps(&log, []string{"reserve", "persist", "confirm"}, map[string]bool{"reserve": true}, "", ""))
+
+	saga := NewSaga("saga1", SagaData{})
+	if err := o.Run(context.Background(), saga); err != ErrSagaLeaseLost {
+		t.Errorf("Run = %v; want %v", err, ErrSagaLeaseLost)
+	}
+	// The run stops as soon as a save fails and leaves the rest, including
+	// any compensation, to the run that claimed the saga.
+	if want := []string{"reserve", "persist"}; !reflect.DeepEqual(log, want) {
+		t.Errorf("ran %v; want %v", log, want)
+	}
+}
+
+func TestOrchestratorRenewsLease(t *testing.T) {
+	store := &fakeSagaStore{}
+	var leases []time.Time
+	steps := []SagaStep{}
+	for i := 0; i < 3; i++ {
+		steps = append(steps, SagaStep{
+			Name: "step",
+			Action: func(ctx context.Context, saga *Saga) error {
+				if !saga.LeaseUntil.After(time.Now().UTC()) {
+					t.Errorf("step %d started without a lease", saga.Step)
+				}
+				leases = append(leases, saga.LeaseUntil)
+				time.Sleep(time.Millisecond)
+				return nil
+			},
+		})
+	}
+
+	saga := NewSaga("saga1", SagaData{})
+	if err := NewOrchestrator(store, steps).Run(context.Background(), saga); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(leases); i++ {
+		if !leases[i].After(leases[i-1]) {
+			t.Errorf("lease before step %d is %v, not renewed from %v", i, leases[i], leases[i-1])
+		}
+	}
+}
+
+func TestStepName(t *testing.T) {
+	o := NewOrchestrator(&fakeSagaStore{}, recordedSteps(&[]string{}, []string{"reserve", "persist"}, nil, "", ""))
+
+	tests := []struct {
+		status SagaStatus
+		step   int
+		want   string
+	}{
+		{SagaRunning, 0, "reserve"},
+		{SagaRunning, 1, "persist"},
+		{SagaCompleted, 2, ""},
+		{SagaCompensating, 2, "persist"},
+		{SagaCompensating, 1, "reserve"},
+		{SagaFailed, 2, "persist"},
+		{SagaCompensated, 0, ""},
+	}
+	for _, tt := range tests {
+		if got := o.StepName(&Saga{Status: tt.status, Step: tt.step}); got != tt.want {
+			t.Errorf("StepName(%s at %d) = %q; want %q", tt.status, tt.step, got, tt.want)
+		}
+	}
+}
@@ -6,12 +6,17 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"time"
 
 	"github.com/jaykapade/cart-microservice/account"
 	"github.com/jaykapade/cart-microservice/catalog"
+	"github.com/jaykapade/cart-microservice/money"
 	"github.com/jaykapade/cart-microservice/order/pb"
+	"github.com/segmentio/ksuid"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 type grpcServer struct {
@@ -19,6 +24,7 @@ type grpcServer struct {
 	service       Service
 	accountClient *account.Client
 	catalogClient *catalog.Client
+	orchestrator  *Orchestrator
 }
 
 func ListenGRPC(s Service, accountURL string, catalogURL string, port int) error {
@@ -41,144 +47,339 @@ func ListenGRPC(s Service, accountURL string, catalogURL string, port int) error
 
 	serv := grpc.NewServer()
 
-	pb.RegisterOrderServiceServer(serv, &grpcServer{
+	srv := &grpcServer{
 		UnimplementedOrderServiceServer: pb.UnimplementedOrderServiceServer{},
 		service:                         s,
 		accountClient:                   accountClient,
 		catalogClient:                   catalogClient,
-	})
+	}
+	srv.orchestrator = NewOrchestrator(s, srv.checkoutSteps())
+	go srv.resumeSagas()
+
+	pb.RegisterOrderServiceServer(serv, srv)
 
 	reflection.Register(serv)
 	return serv.Serve(lis)
 }
 
+func (s *grpcServer) GetOrder(ctx context.Context, r *pb.GetOrderRequest) (*pb.GetOrderResponse, error) {
+	o, err := s.service.GetOrder(ctx, r.Id)
+	if err == ErrNotFound {
+		return nil, status.Errorf(codes.NotFound, "order %s not found", r.Id)
+	}
+	if err != nil {
+		log.Println("Error getting order", err)
+		return nil, errors.New("Error getting order")
+	}
+
+	s.enrichProducts(ctx, []*Order{o})
+
+	return &pb.GetOrderResponse{
+		Order: orderToProto(o),
+	}, nil
+}
+
+func (s *grpcServer) UpdateOrderStatus(ctx context.Context, r *pb.UpdateOrderStatusRequest) (*pb.UpdateOrderStatusResponse, error) {
+	o, err := s.service.UpdateOrderStatus(ctx, r.Id, Status(r.Status))
+	switch err {
+	case nil:
+	case ErrNotFound:
+		return nil, status.Errorf(codes.NotFound, "order %s not found", r.Id)
+	case ErrInvalidStatus:
+		return nil, status.Errorf(codes.InvalidArgument, "invalid order status %q", r.Status)
+	case ErrInvalidTransition:
+		return nil, status.Errorf(codes.FailedPrecondition, "order %s cannot move to status %q", r.Id, r.Status)
+	default:
+		log.Println("Error updating order status", err)
+		return nil, errors.New("Error updating order status")
+	}
+
+	s.enrichProducts(ctx, []*Order{o})
+
+	return &pb.UpdateOrderStatusResponse{
+		Order: orderToProto(o),
+	}, nil
+}
+
 func (s *grpcServer) GetOrdersForAccount(ctx context.Context, r *pb.GetOrdersForAccountRequest) (*pb.GetOrdersForAccountResponse, error) {
-	accountOrders, err := s.service.GetOrdersForAccount(ctx, r.AccountId)
+	accountOrders, next, err := s.service.GetOrdersForAccount(ctx, r.AccountId, filterFromProto(r.Filter), r.After, r.Take)
+	if err == ErrInvalidCursor || err == ErrInvalidFilter {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	if err != nil {
 		log.Println("Error getting orders for account", err)
 		return nil, errors.New("Error getting orders for account")
 	}
 
-	productIDMap := map[string]bool{}
+	s.enrichProducts(ctx, accountOrders)
+
+	orders := []*pb.Order{}
 	for _, o := range accountOrders {
-		for _, p := range o.Products {
-			productIDMap[p.ID] = true
-		}
+		orders = append(orders, orderToProto(o))
 	}
 
-	productIDs := []string{}
-	for id := range productIDMap {
-		productIDs = append(productIDs, id)
-	}
+	return &pb.GetOrdersForAccountResponse{
+		Orders:     orders,
+		NextCursor: next,
+	}, nil
+}
 
-	products, err := s.catalogClient.GetProducts(ctx, 0, 0, productIDs, "")
+func (s *grpcServer) ListOrders(ctx context.Context, r *pb.ListOrdersRequest) (*pb.ListOrdersResponse, error) {
+	orderList, next, err := s.service.ListOrders(ctx, filterFromProto(r.Filter), r.After, r.Take)
+	if err == ErrInvalidCursor || err == ErrInvalidFilter {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	if err != nil {
-		log.Println("Error getting products", err)
-		return nil, errors.New("Error getting products")
+		log.Println("Error listing orders", err)
+		return nil, errors.New("Error listing orders")
 	}
 
+	s.enrichProducts(ctx, orderList)
+
 	orders := []*pb.Order{}
+	for _, o := range orderList {
+		orders = append(orders, orderToProto(o))
+	}
 
-	for _, o := range accountOrders {
-		op := &pb.Order{
-			Id:         o.ID,
-			AccountId:  o.AccountID,
-			TotalPrice: o.TotalPrice,
-			Products:   []*pb.Order_OrderProduct{},
-		}
+	return &pb.ListOrdersResponse{
+		Orders:     orders,
+		NextCursor: next,
+	}, nil
+}
 
-		op.CreatedAt, _ = o.CreatedAt.MarshalBinary()
+func (s *grpcServer) PostOrder(ctx context.Context, r *pb.PostOrderRequest) (*pb.PostOrderResponse, error) {
+	requested := []*OrderedProduct{}
+	for _, p := range r.Products {
+		requested = append(requested, &OrderedProduct{ID: p.ProductId, SKU: p.Sku, Quantity: p.Quantity})
+	}
 
-		for _, product := range o.Products {
-			for _, p := range products {
-				if product.ID == p.ID {
-					product.Name = p.Name
-					product.Description = p.Description
-					product.Price = p.Price
-					break
-				}
-			}
+	var key *IdempotencyKey
+	if r.IdempotencyKey != "" {
+		key = &IdempotencyKey{
+			Key:         r.IdempotencyKey,
+			Fingerprint: Fingerprint(r.AccountId, r.ShippingAddressId, requested),
+		}
 
-			op.Products = append(op.Products, &pb.Order_OrderProduct{
-				Id:          product.ID,
-				Name:        product.Name,
-				Description: product.Description,
-				Price:       product.Price,
-				Quantity:    product.Quantity,
-			})
+		o, err := s.service.GetOrderForIdempotencyKey(ctx, r.AccountId, key)
+		switch err {
+		case nil:
+			return &pb.PostOrderResponse{Order: orderToProto(o)}, nil
+		case ErrNotFound:
+		case ErrIdempotencyKeyReused:
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		default:
+			log.Println("Error getting order for idempotency key", err)
+			return nil, errors.New("Error posting order")
 		}
+	}
 
-		orders = append(orders, op)
+	saga := NewSaga(ksuid.New().String(), SagaData{
+		AccountID:         r.AccountId,
+		ShippingAddressID: r.ShippingAddressId,
+		Products:          requested,
+		IdempotencyKey:    key,
+	})
+
+	// The saga must not be abandoned halfway if the caller gives up, so it
+	// runs on its own deadline.
+	sagaCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
 
+	err := s.orchestrator.Run(sagaCtx, saga)
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrEmptyOrder):
+		return nil, status.Error(codes.InvalidArgument, "no orderable products")
+	case errors.Is(err, ErrInvalidVariant), errors.Is(err, ErrInvalidAddress):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, money.ErrCurrencyMismatch):
+		return nil, status.Error(codes.InvalidArgument, "products are priced in different currencies")
+	case errors.Is(err, ErrIdempotencyKeyReused):
+		return nil, status.Error(codes.AlreadyExists, ErrIdempotencyKeyReused.Error())
+	case errors.Is(err, ErrOutOfStock):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		log.Println("Error posting order, saga", saga.ID, err)
+		return nil, fmt.Errorf("Error posting order (saga %s)", saga.ID)
 	}
 
-	return &pb.GetOrdersForAccountResponse{
-		Orders: orders,
+	return &pb.PostOrderResponse{
+		Order: orderToProto(saga.Data.Order),
 	}, nil
 }
 
-func (s *grpcServer) PostOrder(ctx context.Context, r *pb.PostOrderRequest) (*pb.PostOrderResponse, error) {
-	_, err := s.accountClient.GetAccount(ctx, r.AccountId)
+func (s *grpcServer) AnonymizeAccountOrders(ctx context.Context, r *pb.AnonymizeAccountOrdersRequest) (*pb.AnonymizeAccountOrdersResponse, error) {
+	if r.AccountId == "" || r.AccountId == DeletedAccountID {
+		return nil, status.Error(codes.InvalidArgument, "invalid account id")
+	}
+	n, err := s.service.AnonymizeAccountOrders(ctx, r.AccountId)
 	if err != nil {
-		log.Println("Error getting account", err)
-		return nil, errors.New("Error getting account")
+		log.Println("Error anonymizing orders", err)
+		return nil, errors.New("Error anonymizing orders")
+	}
+	return &pb.AnonymizeAccountOrdersResponse{Orders: uint64(n)}, nil
+}
+
+func (s *grpcServer) GetSaga(ctx context.Context, r *pb.GetSagaRequest) (*pb.GetSagaResponse, error) {
+	saga, err := s.service.GetSaga(ctx, r.Id)
+	if err == ErrNotFound {
+		return nil, status.Errorf(codes.NotFound, "saga %s not found", r.Id)
 	}
-	productIds := []string{}
-	orderedPdts, err := s.catalogClient.GetProducts(ctx, 0, 0, productIds, "")
 	if err != nil {
-		log.Println("Error getting products", err)
-		return nil, errors.New("Error getting products")
+		log.Println("Error getting saga", err)
+		return nil, errors.New("Error getting saga")
 	}
 
-	products := []*OrderedProduct{}
-	for _, pdt := range orderedPdts {
-		product := OrderedProduct{
-			ID:          pdt.ID,
-			Name:        pdt.Name,
-			Description: pdt.Description,
-			Price:       pdt.Price,
-			Quantity:    0,
-		}
+	sp := &pb.Saga{
+		Id:             saga.ID,
+		Status:         string(saga.Status),
+		Step:           s.orchestrator.StepName(saga),
+		CompletedSteps: uint32(saga.Step),
+		Error:          saga.Error,
+	}
+	sp.CreatedAt, _ = saga.CreatedAt.MarshalBinary()
+	sp.UpdatedAt, _ = saga.UpdatedAt.MarshalBinary()
 
-		for _, order := range r.Products {
-			if order.ProductId == pdt.ID {
-				product.Quantity = order.Quantity
-				break
-			}
-		}
+	return &pb.GetSagaResponse{Saga: sp}, nil
+}
 
-		if product.Quantity > 0 {
-			products = append(products, &product)
+// enrichProducts fills in the names and descriptions of lines stored before
+// product details were snapshotted at order time from the live catalog. Their
+// prices stay unknown, as the catalog only has today's price. Lines that
+// already carry a snapshot are left alone, and catalog failures only cost the
+// enrichment.
+func (s *grpcServer) enrichProducts(ctx context.Context, orders []*Order) {
+	productIDMap := map[string]bool{}
+	for _, o := range orders {
+		for _, p := range o.Products {
+			if p.Name == "" {
+				productIDMap[p.ID] = true
+			}
 		}
 	}
 
-	o, err := s.service.PostOrder(ctx, r.AccountId, products)
+	productIDs := []string{}
+	for id := range productIDMap {
+		productIDs = append(productIDs, id)
+	}
+	if len(productIDs) == 0 {
+		return
+	}
 
+	products, err := s.catalogClient.GetProducts(ctx, 0, 0, productIDs, "", catalog.ProductFilter{})
 	if err != nil {
-		log.Println("Error posting order", err)
-		return nil, errors.New("Error posting order")
+		log.Println("Error getting products", err)
+		return
+	}
+
+	for _, o := range orders {
+		for _, product := range o.Products {
+			if product.Name != "" {
+				continue
+			}
+			for _, p := range products {
+				if product.ID == p.ID {
+					product.Name = p.Name
+					product.Description = p.Description
+					break
+				}
+			}
+		}
 	}
+}
 
-	orderProto := &pb.Order{
+func orderToProto(o *Order) *pb.Order {
+	op := &pb.Order{
 		Id:         o.ID,
 		AccountId:  o.AccountID,
-		TotalPrice: o.TotalPrice,
+		TotalPrice: money.ToProto(o.TotalPrice),
+		Status:     string(o.Status),
 		Products:   []*pb.Order_OrderProduct{},
 	}
 
-	orderProto.CreatedAt, _ = o.CreatedAt.MarshalBinary()
+	op.CreatedAt, _ = o.CreatedAt.MarshalBinary()
+
+	if a := o.ShippingAddress; a != nil {
+		op.ShippingAddress = &pb.ShippingAddress{
+			AddressId:  a.AddressID,
+			Recipient:  a.Recipient,
+			Line1:      a.Line1,
+			Line2:      a.Line2,
+			City:       a.City,
+			PostalCode: a.PostalCode,
+			Country:    a.Country,
+		}
+	}
+
+	for _, c := range o.StatusHistory {
+		change := &pb.Order_StatusChange{Status: string(c.Status)}
+		change.CreatedAt, _ = c.CreatedAt.MarshalBinary()
+		op.StatusHistory = append(op.StatusHistory, change)
+	}
 
 	for _, p := range o.Products {
-		orderProto.Products = append(orderProto.Products, &pb.Order_OrderProduct{
+		pp := &pb.Order_OrderProduct{
 			Id:          p.ID,
+			Sku:         p.SKU,
 			Name:        p.Name,
 			Description: p.Description,
-			Price:       p.Price,
+			Attributes:  p.Attributes,
 			Quantity:    p.Quantity,
-		})
+		}
+		if p.Price != nil {
+			pp.Price = money.ToProto(*p.Price)
+		}
+		op.Products = append(op.Products, pp)
 	}
 
-	return &pb.PostOrderResponse{
-		Order: orderProto,
-	}, nil
+	return op
+}
+
+func filterFromProto(f *pb.OrderFilter) OrderFilter {
+	filter := OrderFilter{}
+	if f == nil {
+		return filter
+	}
+
+	filter.AccountID = f.AccountId
+	filter.ProductID = f.ProductId
+	filter.Sort = Sort(f.Sort)
+	if len(f.CreatedAfter) > 0 {
+		filter.CreatedAfter.UnmarshalBinary(f.CreatedAfter)
+	}
+	if len(f.CreatedBefore) > 0 {
+		filter.CreatedBefore.UnmarshalBinary(f.CreatedBefore)
+	}
+	if f.MinTotal != nil {
+		m := money.FromProto(f.MinTotal)
+		filter.MinTotal = &m
+	}
+	if f.MaxTotal != nil {
+		m := money.FromProto(f.MaxTotal)
+		filter.MaxTotal = &m
+	}
+
+	return filter
+}
+
+func filterToProto(f OrderFilter) *pb.OrderFilter {
+	fp := &pb.OrderFilter{
+		AccountId: f.AccountID,
+		ProductId: f.ProductID,
+		Sort:      string(f.Sort),
+	}
+	if !f.CreatedAfter.IsZero() {
+		fp.CreatedAfter, _ = f.CreatedAfter.MarshalBinary()
+	}
+	if !f.CreatedBefore.IsZero() {
+		fp.CreatedBefore, _ = f.CreatedBefore.MarshalBinary()
+	}
+	if f.MinTotal != nil {
+		fp.MinTotal = money.ToProto(*f.MinTotal)
+	}
+	if f.MaxTotal != nil {
+		fp.MaxTotal = money.ToProto(*f.MaxTotal)
+	}
+
+	return fp
 }
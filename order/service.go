@@ -2,61 +2,303 @@ package order
 
 import (
 	"context"
+	"errors"
+	"log"
+	"strings"
 	"time"
 
+	"github.com/jaykapade/cart-microservice/keyset"
+	"github.com/jaykapade/cart-microservice/money"
+	"github.com/jaykapade/cart-microservice/notify"
 	"github.com/segmentio/ksuid"
 )
 
+var (
+	ErrEmptyOrder = errors.New("order has no products")
+	ErrNoPrice    = errors.New("order line has no price")
+	ErrOutOfStock = errors.New("out of stock")
+	// ErrInvalidVariant is returned for a line naming an unknown or inactive
+	// SKU, or none for a product that is only sold as variants.
+	ErrInvalidVariant = errors.New("invalid product variant")
+	// ErrInvalidAddress is returned for a shipping address ID that is not in
+	// the ordering account's address book.
+	ErrInvalidAddress = errors.New("invalid shipping address")
+)
+
 type Service interface {
-	PostOrder(ctx context.Context, accountID string, products []*OrderedProduct) (*Order, error)
-	GetOrdersForAccount(ctx context.Context, accountID string) ([]*Order, error)
+	PostOrder(ctx context.Context, o *Order, key *IdempotencyKey) (*Order, error)
+	DeleteOrder(ctx context.Context, id string) error
+	NotifyOrderPlaced(ctx context.Context, o *Order)
+	GetOrderForIdempotencyKey(ctx context.Context, accountID string, key *IdempotencyKey) (*Order, error)
+	GetOrder(ctx context.Context, id string) (*Order, error)
+	UpdateOrderStatus(ctx context.Context, id string, status Status) (*Order, error)
+	GetOrdersForAccount(ctx context.Context, accountID string, filter OrderFilter, after string, take uint64) ([]*Order, string, error)
+	ListOrders(ctx context.Context, filter OrderFilter, after string, take uint64) ([]*Order, string, error)
+	SaveSaga(ctx context.Context, saga *Saga) error
+	GetSaga(ctx context.Context, id string) (*Saga, error)
+	ListStaleSagas(ctx context.Context, now time.Time) ([]*Saga, error)
+	ClaimSaga(ctx context.Context, id string, now time.Time) (*Saga, error)
+	AnonymizeAccountOrders(ctx context.Context, accountID string) (int64, error)
 }
 
+// DeletedAccountID replaces the account ID of the orders of deleted accounts.
+var DeletedAccountID = ksuid.Nil.String()
+
 type Order struct {
-	ID         string
-	CreatedAt  time.Time
-	TotalPrice float64
-	AccountID  string
-	Products   []*OrderedProduct
+	ID              string
+	CreatedAt       time.Time
+	TotalPrice      money.Money
+	AccountID       string
+	Status          Status
+	StatusHistory   []*StatusChange
+	Products        []*OrderedProduct
+	ShippingAddress *ShippingAddress
+}
+
+// ShippingAddress is where an order ships to, copied from the account's
+// address book when the order is placed so that later edits to the address
+// book do not change it. AddressID records which entry it was copied from.
+type ShippingAddress struct {
+	AddressID  string `json:"addressId"`
+	Recipient  string `json:"recipient"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city"`
+	PostalCode string `json:"postalCode,omitempty"`
+	Country    string `json:"country"`
 }
 
+// OrderedProduct is an order line. Name, Description, Price and the
+// variant's Attributes are captured from the catalog when the order is placed
+// and do not follow later changes. SKU is empty for products without
+// variants. Price is nil on lines stored before prices were captured, whose
+// price is unknown.
 type OrderedProduct struct {
 	ID          string
+	SKU         string
 	Name        string
 	Description string
-	Price       float64
+	Attributes  map[string]string
+	Price       *money.Money
 	Quantity    uint32
 }
 
 type OrderService struct {
 	repository Repository
+	notifier   notify.Notifier
 }
 
-func NewOrderService(r Repository) *OrderService {
-	return &OrderService{repository: r}
+// NewOrderService returns a service that confirms placed orders through
+// notifier.
+func NewOrderService(r Repository, notifier notify.Notifier) *OrderService {
+	return &OrderService{repository: r, notifier: notifier}
+}
+
+func (s *OrderService) GetOrder(ctx context.Context, id string) (*Order, error) {
+	return s.repository.GetOrder(ctx, id)
+}
+
+// GetOrdersForAccount returns a page of the account's orders and the cursor
+// for the next page, which is empty on the last page.
+func (s *OrderService) GetOrdersForAccount(ctx context.Context, accountID string, filter OrderFilter, after string, take uint64) ([]*Order, string, error) {
+	filter.AccountID = accountID
+	return s.listOrders(ctx, filter, after, take)
+}
+
+// ListOrders returns a page of orders across all accounts.
+func (s *OrderService) ListOrders(ctx context.Context, filter OrderFilter, after string, take uint64) ([]*Order, string, error) {
+	return s.listOrders(ctx, filter, after, take)
+}
+
+func (s *OrderService) listOrders(ctx context.Context, filter OrderFilter, after string, take uint64) ([]*Order, string, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, "", err
+	}
+	cursor, err := keyset.Decode(after)
+	if err != nil {
+		return nil, "", err
+	}
+	if take > 100 || take == 0 {
+		take = 100
+	}
+
+	orders, err := s.repository.ListOrders(ctx, filter, cursor, take+1)
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if uint64(len(orders)) > take {
+		orders = orders[:take]
+		last := orders[len(orders)-1]
+		next = keyset.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	return orders, next, nil
 }
 
-func (s *OrderService) GetOrdersForAccount(ctx context.Context, accountID string) ([]*Order, error) {
-	return s.repository.GetOrdersForAccount(ctx, accountID)
+// GetOrderForIdempotencyKey returns the order previously created with key,
+// ErrNotFound if the key is unused, or ErrIdempotencyKeyReused if it was used
+// for a different request.
+func (s *OrderService) GetOrderForIdempotencyKey(ctx context.Context, accountID string, key *IdempotencyKey) (*Order, error) {
+	stored, err := s.repository.GetIdempotencyKey(ctx, accountID, key.Key)
+	if err != nil {
+		return nil, err
+	}
+	if stored.Fingerprint != key.Fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+	return s.repository.GetOrder(ctx, stored.OrderID)
 }
 
-func (s *OrderService) PostOrder(ctx context.Context, accountID string, products []*OrderedProduct) (*Order, error) {
+// NewOrder prices the products into a pending order with the given ID.
+func NewOrder(id string, accountID string, products []*OrderedProduct) (*Order, error) {
+	if len(products) == 0 {
+		return nil, ErrEmptyOrder
+	}
+	for _, p := range products {
+		if p.Price == nil {
+			return nil, ErrNoPrice
+		}
+	}
+
 	o := &Order{
-		ID:         ksuid.New().String(),
-		CreatedAt:  time.Now().UTC(),
-		TotalPrice: 100,
+		ID:         id,
+		CreatedAt:  time.Now().UTC().Truncate(time.Microsecond),
+		TotalPrice: money.Zero(products[0].Price.Currency),
 		AccountID:  accountID,
+		Status:     StatusPending,
 		Products:   products,
 	}
+	o.StatusHistory = []*StatusChange{{Status: o.Status, CreatedAt: o.CreatedAt}}
 
-	o.TotalPrice = 0.0
 	for _, p := range products {
-		o.TotalPrice += p.Price * float64(p.Quantity)
+		line, err := p.Price.Mul(p.Quantity)
+		if err != nil {
+			return nil, err
+		}
+		o.TotalPrice, err = o.TotalPrice.Add(line)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// PostOrder stores the order. Storing an order that already exists returns
+// the stored one, so a resumed checkout does not fail on its own write.
+func (s *OrderService) PostOrder(ctx context.Context, o *Order, key *IdempotencyKey) (*Order, error) {
+	existing, err := s.repository.GetOrder(ctx, o.ID)
+	if err == nil {
+		return existing, nil
+	}
+	if err != ErrNotFound {
+		return nil, err
 	}
-	err := s.repository.PutOrder(ctx, o)
+
+	err = s.repository.PutOrder(ctx, o, key)
+	if err == ErrDuplicateIdempotencyKey {
+		// A concurrent request with the same key won the race.
+		return s.GetOrderForIdempotencyKey(ctx, o.AccountID, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// NotifyOrderPlaced queues the confirmation of o for its account. Failing to
+// do so is logged and does not fail the order.
+func (s *OrderService) NotifyOrderPlaced(ctx context.Context, o *Order) {
+	placed := notify.OrderPlaced{
+		OrderID:   o.ID,
+		CreatedAt: o.CreatedAt,
+		Total:     o.TotalPrice.String() + " " + o.TotalPrice.Currency,
+	}
+	for _, p := range o.Products {
+		line := notify.OrderLine{
+			Name:     p.Name,
+			SKU:      p.SKU,
+			Quantity: p.Quantity,
+		}
+		if p.Price != nil {
+			line.Price = p.Price.String() + " " + p.Price.Currency
+		}
+		placed.Lines = append(placed.Lines, line)
+	}
+	if a := o.ShippingAddress; a != nil {
+		placed.ShippingAddress = []string{a.Recipient, a.Line1}
+		if a.Line2 != "" {
+			placed.ShippingAddress = append(placed.ShippingAddress, a.Line2)
+		}
+		placed.ShippingAddress = append(placed.ShippingAddress,
+			strings.TrimSpace(a.PostalCode+" "+a.City), a.Country)
+	}
+
+	m, err := notify.OrderPlacedMessage(notify.Recipient{AccountID: o.AccountID}, placed)
+	if err == nil {
+		err = s.notifier.Notify(ctx, m)
+	}
+	if err != nil {
+		log.Println("Error notifying order", o.ID, err)
+	}
+}
+
+func (s *OrderService) DeleteOrder(ctx context.Context, id string) error {
+	return s.repository.DeleteOrder(ctx, id)
+}
+
+func (s *OrderService) SaveSaga(ctx context.Context, saga *Saga) error {
+	return s.repository.PutSaga(ctx, saga)
+}
+
+func (s *OrderService) GetSaga(ctx context.Context, id string) (*Saga, error) {
+	return s.repository.GetSaga(ctx, id)
+}
+
+// ListStaleSagas returns unfinished sagas whose lease ran out before now,
+// i.e. those abandoned by a stopped or stuck run.
+func (s *OrderService) ListStaleSagas(ctx context.Context, now time.Time) ([]*Saga, error) {
+	return s.repository.ListStaleSagas(ctx, now)
+}
+
+// ClaimSaga takes over a stale saga for a new run with a fresh lease. It
+// returns ErrNotFound if the saga was claimed by another run or finished
+// meanwhile.
+func (s *OrderService) ClaimSaga(ctx context.Context, id string, now time.Time) (*Saga, error) {
+	return s.repository.ClaimSaga(ctx, id, ksuid.New().String(), now.Add(sagaLease), now)
+}
+
+// AnonymizeAccountOrders detaches the orders of a deleted account from it
+// and returns how many there were. Sagas still placing an order for the
+// account are not affected.
+func (s *OrderService) AnonymizeAccountOrders(ctx context.Context, accountID string) (int64, error) {
+	return s.repository.AnonymizeAccount(ctx, accountID)
+}
+
+func (s *OrderService) UpdateOrderStatus(ctx context.Context, id string, status Status) (*Order, error) {
+	if !status.Valid() {
+		return nil, ErrInvalidStatus
+	}
+
+	o, err := s.repository.GetOrder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !o.Status.CanTransitionTo(status) {
+		return nil, ErrInvalidTransition
+	}
+
+	change := &StatusChange{Status: status, CreatedAt: time.Now().UTC()}
+	err = s.repository.UpdateOrderStatus(ctx, o.ID, o.Status, change)
 	if err != nil {
 		return nil, err
 	}
 
+	o.Status = status
+	o.StatusHistory = append(o.StatusHistory, change)
 	return o, nil
 }
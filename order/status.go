@@ -0,0 +1,52 @@
+package order
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidStatus     = errors.New("invalid order status")
+	ErrInvalidTransition = errors.New("invalid order status transition")
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusPaid      Status = "paid"
+	StatusFulfilled Status = "fulfilled"
+	StatusShipped   Status = "shipped"
+	StatusDelivered Status = "delivered"
+	StatusCancelled Status = "cancelled"
+)
+
+// transitions lists the statuses an order may move to from each status.
+// Delivered and cancelled orders are final.
+var transitions = map[Status][]Status{
+	StatusPending:   {StatusPaid, StatusCancelled},
+	StatusPaid:      {StatusFulfilled, StatusCancelled},
+	StatusFulfilled: {StatusShipped, StatusCancelled},
+	StatusShipped:   {StatusDelivered},
+	StatusDelivered: {},
+	StatusCancelled: {},
+}
+
+type StatusChange struct {
+	Status    Status
+	CreatedAt time.Time
+}
+
+func (s Status) Valid() bool {
+	_, ok := transitions[s]
+	return ok
+}
+
+func (s Status) CanTransitionTo(next Status) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
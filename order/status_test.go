@@ -0,0 +1,119 @@
+package order
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var allStatuses = []Status{StatusPending, StatusPaid, StatusFulfilled, StatusShipped, StatusDelivered, StatusCancelled}
+
+func TestCanTransitionTo(t *testing.T) {
+	allowed := map[Status][]Status{
+		StatusPending:   {StatusPaid, StatusCancelled},
+		StatusPaid:      {StatusFulfilled, StatusCancelled},
+		StatusFulfilled: {StatusShipped, StatusCancelled},
+		StatusShipped:   {StatusDelivered},
+	}
+
+	for _, from := range allStatuses {
+		for _, to := range allStatuses {
+			want := false
+			for _, s := range allowed[from] {
+				want = want || s == to
+			}
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%s.CanTransitionTo(%s) = %v; want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestStatusValid(t *testing.T) {
+	for _, s := range allStatuses {
+		if !s.Valid() {
+			t.Errorf("%s.Valid() = false; want true", s)
+		}
+	}
+	for _, s := range []Status{"", "Pending", "refunded"} {
+		if s.Valid() {
+			t.Errorf("%q.Valid() = true; want false", s)
+		}
+		if StatusPending.CanTransitionTo(s) {
+			t.Errorf("pending.CanTransitionTo(%q) = true; want false", s)
+		}
+	}
+}
+
+// statusRepository is a Repository holding a single order. Only the methods
+// UpdateOrderStatus uses are implemented.
+type statusRepository struct {
+	Repository
+	order   *Order
+	updates []Status
+}
+
+func (r *statusRepository) GetOrder(ctx context.Context, id string) (*Order, error) {
+	if id != r.order.ID {
+		return nil, ErrNotFound
+	}
+	o := *r.order
+	return &o, nil
+}
+
+func (r *statusRepository) UpdateOrderStatus(ctx context.Context, id string, from Status, change *StatusChange) error {
+	if from != r.order.Status {
+		return ErrInvalidTransition
+	}
+	r.order.Status = change.Status
+	r.updates = append(r.updates, change.Status)
+	return nil
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	tests := []struct {
+		from Status
+		to   Status
+		err  error
+	}{
+		{StatusPending, StatusPaid, nil},
+		{StatusPaid, StatusFulfilled, nil},
+		{StatusShipped, StatusDelivered, nil},
+		{StatusFulfilled, StatusCancelled, nil},
+		{StatusPending, StatusShipped, ErrInvalidTransition},
+		{StatusShipped, StatusCancelled, ErrInvalidTransition},
+		{StatusDelivered, StatusPending, ErrInvalidTransition},
+		{StatusCancelled, StatusPaid, ErrInvalidTransition},
+		{StatusPaid, StatusPaid, ErrInvalidTransition},
+		{StatusPending, "refunded", ErrInvalidStatus},
+	}
+
+	for _, tt := range tests {
+		r := &statusRepository{order: &Order{ID: "order1", Status: tt.from}}
+		s := NewOrderService(r, nil)
+
+		o, err := s.UpdateOrderStatus(context.Background(), "order1", tt.to)
+		if err != tt.err {
+			t.Errorf("%s -> %s: UpdateOrderStatus = %v; want %v", tt.from, tt.to, err, tt.err)
+			continue
+		}
+		if tt.err != nil {
+			if len(r.updates) != 0 {
+				t.Errorf("%s -> %s: stored %v; want nothing", tt.from, tt.to, r.updates)
+			}
+			continue
+		}
+		if o.Status != tt.to || len(r.updates) != 1 || r.updates[0] != tt.to {
+			t.Errorf("%s -> %s: order is %s, stored %v", tt.from, tt.to, o.Status, r.updates)
+		}
+		last := o.StatusHistory[len(o.StatusHistory)-1]
+		if last.Status != tt.to || time.Since(last.CreatedAt) > time.Minute {
+			t.Errorf("%s -> %s: last history entry is %+v", tt.from, tt.to, last)
+		}
+	}
+
+	s := NewOrderService(&statusRepository{order: &Order{ID: "order1", Status: StatusPending}}, nil)
+	if _, err := s.UpdateOrderStatus(context.Background(), "order2", StatusPaid); err != ErrNotFound {
+		t.Errorf("UpdateOrderStatus of a missing order = %v; want %v", err, ErrNotFound)
+	}
+}
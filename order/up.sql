@@ -5,9 +5,116 @@ CREATE TABLE IF NOT EXISTS orders (
     total_price MONEY NOT NULL
 );
 
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'pending';
+
+-- Totals used to be MONEY amounts. Store them as integer minor units
+-- instead, with their currency. Every order placed before currencies existed
+-- was priced in US dollars, so those totals are converted to cents and marked
+-- USD; the conversion would be wrong for a database whose MONEY amounts were in
+-- a currency without two decimals.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE orders ALTER COLUMN currency DROP DEFAULT;
+DO $$
+BEGIN
+    IF (SELECT data_type FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'orders' AND column_name = 'total_price') = 'money' THEN
+        ALTER TABLE orders ALTER COLUMN total_price TYPE BIGINT
+            USING round(total_price::numeric * 100)::BIGINT;
+    END IF;
+END
+$$;
+
+CREATE INDEX IF NOT EXISTS orders_account_id_created_at_idx ON orders (account_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS orders_created_at_idx ON orders (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS orders_currency_total_price_idx ON orders (currency, total_price);
+
 CREATE TABLE IF NOT EXISTS order_products (
     order_id CHAR(27) NOT NULL,
     product_id CHAR(27) NOT NULL,
     quantity INTEGER NOT NULL,
     PRIMARY KEY (order_id, product_id)
-);
\ No newline at end of file
+);
+
+-- Lines snapshot the product's name, description and unit price when the
+-- order is placed. Lines stored before snapshots existed take their order's
+-- currency but keep a NULL price, as what was paid for them is unknown; the
+-- check constraint is NOT VALID so that it only rejects new lines without a
+-- price.
+ALTER TABLE order_products ADD COLUMN IF NOT EXISTS name VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE order_products ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+ALTER TABLE order_products ADD COLUMN IF NOT EXISTS price BIGINT;
+ALTER TABLE order_products ADD COLUMN IF NOT EXISTS currency CHAR(3);
+UPDATE order_products SET
+    currency = COALESCE((SELECT currency FROM orders WHERE orders.id = order_products.order_id), 'USD')
+    WHERE currency IS NULL;
+ALTER TABLE order_products ALTER COLUMN price DROP NOT NULL;
+ALTER TABLE order_products ALTER COLUMN price DROP DEFAULT;
+ALTER TABLE order_products ALTER COLUMN currency SET NOT NULL;
+ALTER TABLE order_products ALTER COLUMN currency DROP DEFAULT;
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'order_products_price_not_null') THEN
+        ALTER TABLE order_products ADD CONSTRAINT order_products_price_not_null
+            CHECK (price IS NOT NULL) NOT VALID;
+    END IF;
+END
+$$;
+
+-- Lines name the variant bought, so a product may appear once per SKU.
+ALTER TABLE order_products ADD COLUMN IF NOT EXISTS sku VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE order_products ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}';
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_constraint c
+        JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = ANY (c.conkey)
+        WHERE c.conrelid = 'order_products'::regclass AND c.contype = 'p' AND a.attname = 'sku'
+    ) THEN
+        ALTER TABLE order_products DROP CONSTRAINT IF EXISTS order_products_pkey;
+        ALTER TABLE order_products ADD PRIMARY KEY (order_id, product_id, sku);
+    END IF;
+END
+$$;
+
+CREATE INDEX IF NOT EXISTS order_products_product_id_idx ON order_products (product_id);
+
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id SERIAL PRIMARY KEY,
+    order_id CHAR(27) NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    status VARCHAR(16) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS order_status_history_order_id_idx ON order_status_history (order_id);
+
+CREATE TABLE IF NOT EXISTS order_idempotency_keys (
+    account_id CHAR(27) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    fingerprint CHAR(64) NOT NULL,
+    order_id CHAR(27) NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (account_id, idempotency_key)
+);
+
+CREATE TABLE IF NOT EXISTS order_sagas (
+    id CHAR(27) PRIMARY KEY,
+    status VARCHAR(16) NOT NULL,
+    step INTEGER NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    data JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS order_sagas_status_updated_at_idx ON order_sagas (status, updated_at);
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_address JSONB;
+
+-- Each run of a saga holds a lease on it, renewed whenever the saga is
+-- saved. Another run may claim the saga only once the lease has run out, and
+-- the old run's saves then fail. Sagas saved before leases existed have an
+-- expired one.
+ALTER TABLE order_sagas ADD COLUMN IF NOT EXISTS owner VARCHAR(27) NOT NULL DEFAULT '';
+ALTER TABLE order_sagas ADD COLUMN IF NOT EXISTS lease_until TIMESTAMP NOT NULL DEFAULT 'epoch';
+
+CREATE INDEX IF NOT EXISTS order_sagas_status_lease_until_idx ON order_sagas (status, lease_until);